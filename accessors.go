@@ -0,0 +1,306 @@
+package goconf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// value returns the value of key in section.
+func (c *Config) value(section, key string) (string, error) {
+	dict, err := c.Section(section)
+	if err != nil {
+		return "", err
+	}
+	value, ok := dict[c.keyName(key)]
+	if !ok {
+		return "", fmt.Errorf("%w: %q in section %q", ErrKeyNotFound, key, section)
+	}
+	return value, nil
+}
+
+// Get returns the value of key in section, converted to the first of the
+// following types that accepts the value:
+//
+//   - int, when the value is a base 10 integer literal accepted by
+//     strconv.Atoi, such as "42" or "-7";
+//   - bool, when the value is "true" or "false", in any letter case and with
+//     any surrounding whitespace;
+//   - time.Duration, when the value is accepted by time.ParseDuration, such
+//     as "1.5s" or "2h45m";
+//   - string, for any other value.
+//
+// The rules are applied in that order, so "0" is an int rather than a zero
+// duration.  Use the value from Section when the raw string is required.
+func (c *Config) Get(section, key string) (interface{}, error) {
+	value, err := c.value(section, key)
+	if err != nil {
+		return nil, err
+	}
+	if i, err := strconv.Atoi(value); err == nil {
+		return i, nil
+	}
+	if b, ok := parseBool(value); ok {
+		return b, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return d, nil
+	}
+	return value, nil
+}
+
+// GetEnum returns the member of allowed that matches the value of key in
+// section.  Matching ignores letter case and surrounding whitespace, and the
+// member is returned as it appears in allowed, so callers may compare the
+// result against their canonical spelling.  A value matching no member of
+// allowed is an error listing the allowed values.
+func (c *Config) GetEnum(section, key string, allowed []string) (string, error) {
+	value, err := c.value(section, key)
+	if err != nil {
+		return "", err
+	}
+	trimmed := strings.TrimSpace(value)
+	for _, member := range allowed {
+		if strings.EqualFold(trimmed, member) {
+			return member, nil
+		}
+	}
+	return "", fmt.Errorf("invalid value for key %q in section %q: %q; expected one of: %s", key, section, value, strings.Join(allowed, ", "))
+}
+
+// GetPath returns the value of key in section as a file system path cleaned by
+// filepath.Clean.  When the Config was created with ResolvePaths and has a
+// configuration file, a relative path is taken to be relative to the directory
+// holding that file rather than to the working directory of the process, and
+// likewise for the directory of a Config created by NewDir.
+func (c *Config) GetPath(section, key string) (string, error) {
+	value, err := c.value(section, key)
+	if err != nil {
+		return "", err
+	}
+	if c.resolvePaths && !filepath.IsAbs(value) {
+		dir := c.dir
+		if dir == "" && c.pathname != "" {
+			dir = filepath.Dir(c.pathname)
+		}
+		if dir != "" {
+			return filepath.Join(dir, value), nil // Join cleans the result
+		}
+	}
+	return filepath.Clean(value), nil
+}
+
+// GetJSON decodes the value of key in section as JSON into v, as by
+// json.Unmarshal, so a key may hold a small structured setting such as
+// `routes = {"/a":"x","/b":"y"}`.  A value that is not valid JSON, or that
+// does not fit v, is an error naming the section and key.
+func (c *Config) GetJSON(section, key string, v interface{}) error {
+	value, err := c.value(section, key)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal([]byte(value), v); err != nil {
+		return fmt.Errorf("invalid JSON for key %q in section %q: %s", key, section, err)
+	}
+	return nil
+}
+
+// MatchValue reports whether the value of key in section matches the regular
+// expression pattern.  An invalid pattern and a missing key are both returned
+// as errors, while a value that simply does not match returns false and a nil
+// error.
+func (c *Config) MatchValue(section, key, pattern string) (bool, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, fmt.Errorf("invalid value pattern %q: %s", pattern, err)
+	}
+	value, err := c.value(section, key)
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(value), nil
+}
+
+// Provenance returns the name of the file, and the line within it, from which
+// the value of key in section was read.  When layered sources such as an
+// EnvSuffix overlay or an ImportEnvFile file supply a key, the reported
+// position is that of the value in effect.  For a configuration fetched by
+// NewURL the file is the URL, and for values that did not come from a file,
+// such as those of NewJSON, the file is empty and the line is 0.
+func (c *Config) Provenance(section, key string) (file string, line int, err error) {
+	sect, err := c.loadSection(section)
+	if err != nil {
+		return "", 0, err
+	}
+	at, ok := sect.origins[c.keyName(key)]
+	if !ok {
+		return "", 0, fmt.Errorf("%w: %q in section %q", ErrKeyNotFound, key, section)
+	}
+	return at.file, at.line, nil
+}
+
+// ValueWithSource is a value of the configuration along with the name of the
+// file, and the line within it, from which the value was read, as reported by
+// Provenance.
+type ValueWithSource struct {
+	Value string
+	File  string
+	Line  int
+}
+
+// Resolved returns every section of the configuration, keyed by section name,
+// with each key mapped to its value and the position it was read from, all
+// from a single parse.  When layered sources such as an EnvSuffix overlay, an
+// ImportEnvFile file, or the drop-in files of NewDir supply a key, the value
+// and position are those in effect.  Secret references are resolved, while
+// overrides, like for other methods that read the configuration as a whole,
+// are not included.
+func (c *Config) Resolved() (map[string]map[string]ValueWithSource, error) {
+	conf, err := c.sections()
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]map[string]ValueWithSource, len(conf))
+	for name, sect := range conf {
+		if err = c.finishSection(name, sect); err != nil {
+			return nil, err
+		}
+		values := make(map[string]ValueWithSource, len(sect.keys))
+		for _, key := range sect.keys {
+			at := sect.origins[key]
+			values[key] = ValueWithSource{Value: sect.values[key], File: at.file, Line: at.line}
+		}
+		result[name] = values
+	}
+	return result, nil
+}
+
+// lookup returns the value of key in section and whether it is present.  A
+// missing section or key is reported as absent rather than as an error.
+func (c *Config) lookup(section, key string) (string, bool, error) {
+	value, err := c.value(section, key)
+	if err != nil {
+		if errors.Is(err, ErrSectionNotFound) || errors.Is(err, ErrKeyNotFound) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// LookupString returns the value of key in section and true when present, or
+// the empty string and false when either the section or the key is absent.  The
+// error is reserved for failures to read the configuration.
+func (c *Config) LookupString(section, key string) (string, bool, error) {
+	return c.lookup(section, key)
+}
+
+// LookupInt returns the value of key in section parsed by strconv.Atoi and
+// true when present, or 0 and false when either the section or the key is
+// absent.  The error is reserved for failures to read the configuration and
+// for a present value that is not an integer.
+func (c *Config) LookupInt(section, key string) (int, bool, error) {
+	value, ok, err := c.lookup(section, key)
+	if !ok || err != nil {
+		return 0, false, err
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid int for key %q in section %q: %s", key, section, err)
+	}
+	return i, true, nil
+}
+
+// LookupBool returns the value of key in section as a boolean and true when
+// present, or false and false when either the section or the key is absent.
+// As for Get, the value must be "true" or "false", in any letter case and with
+// any surrounding whitespace.  The error is reserved for failures to read the
+// configuration and for a present value that is not a boolean.
+func (c *Config) LookupBool(section, key string) (bool, bool, error) {
+	value, ok, err := c.lookup(section, key)
+	if !ok || err != nil {
+		return false, false, err
+	}
+	b, ok := parseBool(value)
+	if !ok {
+		return false, false, fmt.Errorf("invalid bool for key %q in section %q: %q", key, section, value)
+	}
+	return b, true, nil
+}
+
+// parseBool returns the boolean that value holds, after trimming it and
+// lowering its case, and whether it is "true" or "false" at all.
+func parseBool(value string) (bool, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	}
+	return false, false
+}
+
+// LookupDuration returns the value of key in section parsed by
+// time.ParseDuration and true when present, or 0 and false when either the
+// section or the key is absent.  The error is reserved for failures to read
+// the configuration and for a present value that is not a duration.
+func (c *Config) LookupDuration(section, key string) (time.Duration, bool, error) {
+	value, ok, err := c.lookup(section, key)
+	if !ok || err != nil {
+		return 0, false, err
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid duration for key %q in section %q: %s", key, section, err)
+	}
+	return d, true, nil
+}
+
+// GetStringDefault returns the value of key in section, or def when the
+// section or the key is absent or the configuration cannot be read.  Like the
+// other defaulting accessors, it never fails; use LookupString to tell a
+// missing key from a failure.
+func (c *Config) GetStringDefault(section, key, def string) string {
+	if value, ok, err := c.LookupString(section, key); ok && err == nil {
+		return value
+	}
+	return def
+}
+
+// GetIntDefault returns the value of key in section parsed by strconv.Atoi, or
+// def when the section or the key is absent, when the value is not an integer,
+// or when the configuration cannot be read.  Use LookupInt to tell those cases
+// apart.
+func (c *Config) GetIntDefault(section, key string, def int) int {
+	if i, ok, err := c.LookupInt(section, key); ok && err == nil {
+		return i
+	}
+	return def
+}
+
+// GetBoolDefault returns the value of key in section as a boolean, following
+// the rules of LookupBool, or def when the section or the key is absent, when
+// the value is not a boolean, or when the configuration cannot be read.  Use
+// LookupBool to tell those cases apart.
+func (c *Config) GetBoolDefault(section, key string, def bool) bool {
+	if b, ok, err := c.LookupBool(section, key); ok && err == nil {
+		return b
+	}
+	return def
+}
+
+// GetDurationDefault returns the value of key in section parsed by
+// time.ParseDuration, or def when the section or the key is absent, when the
+// value is not a duration, or when the configuration cannot be read.  Use
+// LookupDuration to tell those cases apart.
+func (c *Config) GetDurationDefault(section, key string, def time.Duration) time.Duration {
+	if d, ok, err := c.LookupDuration(section, key); ok && err == nil {
+		return d
+	}
+	return def
+}
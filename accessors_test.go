@@ -0,0 +1,29 @@
+package goconf
+
+import "testing"
+
+func TestBoolAccessorsMatchGet(t *testing.T) {
+	c, err := New(writeTestFile(t, "[s]\na = tRue  \nb = FALSE\t\nc = yes\nd = 1\n"), PreserveTrailingSpace())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for key, want := range map[string]bool{"a": true, "b": false} {
+		got, ok, err := c.LookupBool("s", key)
+		if !ok || err != nil || got != want {
+			t.Errorf("LookupBool(%q): GOT: %v, %v, %v; WANT: %v, true, nil", key, got, ok, err, want)
+		}
+		if v, err := c.Get("s", key); err != nil || v != want {
+			t.Errorf("Get(%q): GOT: %v, %v; WANT: %v", key, v, err, want)
+		}
+		if got := c.GetBoolDefault("s", key, !want); got != want {
+			t.Errorf("GetBoolDefault(%q): GOT: %v; WANT: %v", key, got, want)
+		}
+	}
+	for _, key := range []string{"c", "d"} {
+		if _, _, err := c.LookupBool("s", key); err == nil {
+			t.Errorf("LookupBool(%q): GOT: nil error; WANT: error", key)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package goconf
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	congomap "github.com/karrick/congomap/v2"
+)
+
+// BackendKind selects the data structure used to cache configuration sections.
+type BackendKind int
+
+const (
+	// BackendCongomap caches sections in a congomap, which is safe for
+	// concurrent use.  It is the default.
+	BackendCongomap BackendKind = iota
+
+	// BackendMutex caches sections in a map guarded by a sync.RWMutex, which
+	// is safe for concurrent use.
+	BackendMutex
+
+	// BackendNoLock caches sections in a map without any locking.  It has the
+	// least overhead, but a Config using it must not be used by more than one
+	// goroutine at a time.
+	BackendNoLock
+)
+
+// Backend mutates a new Config data structure to select the data structure
+// used to cache its sections.  The choice does not change the behavior of any
+// Config method, including expiration of sections after the TTL.
+func Backend(kind BackendKind) func(*Config) error {
+	return func(c *Config) error {
+		switch kind {
+		case BackendCongomap, BackendMutex, BackendNoLock:
+			c.backend = kind
+			return nil
+		default:
+			return fmt.Errorf("unknown backend: %d", kind)
+		}
+	}
+}
+
+// cache is the set of operations Config requires of its section cache.
+type cache interface {
+	LoadStore(string) (interface{}, error)
+	Close() error
+}
+
+// newCache returns a cache of the specified kind that calls lookup to obtain
+// missing or expired values, and expires values after ttl when ttl is greater
+// than 0.
+func newCache(kind BackendKind, lookup func(string) (interface{}, error), ttl time.Duration) (cache, error) {
+	switch kind {
+	case BackendMutex:
+		return &mutexCache{mapCache: newMapCache(lookup, ttl)}, nil
+	case BackendNoLock:
+		return newMapCache(lookup, ttl), nil
+	default:
+		cgms := []congomap.Setter{congomap.Lookup(lookup)}
+		if ttl > 0 {
+			cgms = append(cgms, congomap.TTL(ttl))
+		}
+		return congomap.NewSyncAtomicMap(cgms...) // relatively few config sections
+	}
+}
+
+// mapCache is a cache backed by a plain map.  It is not safe for concurrent
+// use.
+type mapCache struct {
+	lookup func(string) (interface{}, error)
+	ttl    time.Duration
+	db     map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	value  interface{}
+	expiry time.Time // zero value never expires
+}
+
+func newMapCache(lookup func(string) (interface{}, error), ttl time.Duration) *mapCache {
+	return &mapCache{lookup: lookup, ttl: ttl, db: make(map[string]cacheEntry)}
+}
+
+// load returns the value stored for key when it has not expired.
+func (m *mapCache) load(key string) (interface{}, bool) {
+	entry, ok := m.db[key]
+	if !ok || (!entry.expiry.IsZero() && !entry.expiry.After(time.Now())) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (m *mapCache) LoadStore(key string) (interface{}, error) {
+	if value, ok := m.load(key); ok {
+		return value, nil
+	}
+	value, err := m.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	var entry cacheEntry
+	entry.value = value
+	if m.ttl > 0 {
+		entry.expiry = time.Now().Add(m.ttl)
+	}
+	m.db[key] = entry
+	return value, nil
+}
+
+func (m *mapCache) Close() error {
+	m.db = make(map[string]cacheEntry)
+	return nil
+}
+
+// mutexCache is a cache backed by a plain map guarded by a sync.RWMutex.
+type mutexCache struct {
+	lock sync.RWMutex
+	*mapCache
+}
+
+func (m *mutexCache) LoadStore(key string) (interface{}, error) {
+	m.lock.RLock()
+	value, ok := m.load(key)
+	m.lock.RUnlock()
+	if ok {
+		return value, nil
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.mapCache.LoadStore(key) // checks again in case another goroutine stored it
+}
+
+func (m *mutexCache) Close() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.mapCache.Close()
+}
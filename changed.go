@@ -0,0 +1,62 @@
+package goconf
+
+import (
+	"os"
+	"time"
+)
+
+// fileStamp is the size and modification time of a file read by a parse, or
+// a record that the file did not exist, such as an absent EnvSuffix overlay.
+type fileStamp struct {
+	pathname string
+	exists   bool
+	size     int64
+	modTime  time.Time
+}
+
+// statFile returns the current stamp of the file at pathname.  A file that
+// does not exist is not an error.
+func statFile(pathname string) (fileStamp, error) {
+	fi, err := os.Stat(pathname)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fileStamp{pathname: pathname}, nil
+		}
+		return fileStamp{}, err
+	}
+	return fileStamp{pathname: pathname, exists: true, size: fi.Size(), modTime: fi.ModTime()}, nil
+}
+
+// stamp records the current stamp of the file at pathname in s.
+func (s *ParseStats) stamp(pathname string) {
+	st, _ := statFile(pathname) // a failed stat reads back as changed
+	s.stamps = append(s.stamps, st)
+}
+
+// Changed reports whether any file read by the most recent parse of the
+// configuration has since changed size or modification time, been created, or
+// been removed.  The files include EnvSuffix overlays that did not exist when
+// parsed, ImportEnvFile files, and, for a Config created by NewDir, the
+// directory itself, so adding or removing a drop-in file is a change.  It
+// returns true when the configuration has not been parsed yet, and false for
+// a configuration that was not read from files, such as one created by NewURL
+// or NewJSON.  Changed does not parse the configuration; call Reset to have
+// later accesses observe the change.
+func (c *Config) Changed() (bool, error) {
+	c.statsLock.Lock()
+	stats := c.stats
+	c.statsLock.Unlock()
+	if stats == nil {
+		return true, nil
+	}
+	for _, then := range stats.stamps {
+		now, err := statFile(then.pathname)
+		if err != nil {
+			return false, err
+		}
+		if now.exists != then.exists || now.size != then.size || !now.modTime.Equal(then.modTime) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,68 @@
+package goconf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Deprecations mutates a new Config data structure to register deprecated
+// keys, mapping the name of each, written as its section name and key joined
+// by the flat key separator, as in "section.key", to a message such as the
+// name of its replacement.  The section name ends at the first separator.
+// Deprecated keys are reported by Deprecated rather than through a hook, and
+// reading them is unaffected.
+func Deprecations(deprecations map[string]string) func(*Config) error {
+	return func(c *Config) error {
+		if c.deprecations == nil {
+			c.deprecations = make(map[string]string, len(deprecations))
+		}
+		for name, message := range deprecations {
+			c.deprecations[name] = message
+		}
+		return nil
+	}
+}
+
+// DeprecatedKey describes a key of the configuration registered by
+// Deprecations, along with the name of the file, and the line within it, from
+// which its value was read.
+type DeprecatedKey struct {
+	Section string
+	Key     string
+	Message string
+	File    string
+	Line    int
+}
+
+// Deprecated returns every key of the configuration registered by
+// Deprecations, ordered by section name and then by the order keys first
+// appear in the section, all from a single parse.  A configuration using no
+// deprecated keys returns an empty slice.  A registered name without the flat
+// key separator is an error.
+func (c *Config) Deprecated() ([]DeprecatedKey, error) {
+	type name struct{ section, key string }
+	messages := make(map[name]string, len(c.deprecations))
+	for flat, message := range c.deprecations {
+		i := strings.Index(flat, c.flatKeySeparator)
+		if i < 0 {
+			return nil, fmt.Errorf("invalid deprecated key %q: expected section and key joined by %q", flat, c.flatKeySeparator)
+		}
+		messages[name{c.sectionName(flat[:i]), c.keyName(flat[i+len(c.flatKeySeparator):])}] = message
+	}
+
+	conf, err := c.sections()
+	if err != nil {
+		return nil, err
+	}
+	found := []DeprecatedKey{}
+	for _, sectName := range sortedSectionNames(conf) {
+		sect := conf[sectName]
+		for _, key := range sect.keys {
+			if message, ok := messages[name{sectName, key}]; ok {
+				at := sect.origins[key]
+				found = append(found, DeprecatedKey{Section: sectName, Key: key, Message: message, File: at.file, Line: at.line})
+			}
+		}
+	}
+	return found, nil
+}
@@ -0,0 +1,64 @@
+package goconf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// NewDir returns a new Config data structure whose configuration is the merge
+// of every regular file, or symbolic link to one, in dir whose name ends in
+// ".conf", read in lexical order of their names, with values in later files
+// replacing those in earlier ones.  Like a drop-in directory, there is no base
+// file: a directory without any such files yields a configuration holding only
+// an empty default section, while a missing directory is an error.  The
+// directory is scanned again each time the configuration is read, so files
+// added or removed are observed after the TTL.
+func NewDir(dir string, setters ...ConfigSetter) (*Config, error) {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("not a directory: %q", dir)
+	}
+
+	c := &Config{dir: dir}
+	c.load = c.loadDir
+	return c.init(setters)
+}
+
+// loadDir parses and merges the configuration files in the directory of c.
+func (c *Config) loadDir(stats *ParseStats) (map[string]*section, error) {
+	entries, err := os.ReadDir(c.dir) // sorted by file name
+	if err != nil {
+		return nil, err
+	}
+	stats.stamp(c.dir) // adding or removing a file changes the directory
+	conf := make(map[string]*section)
+	conf[c.defaultSection] = newSection() // always a default section
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".conf") {
+			continue
+		}
+		pathname := filepath.Join(c.dir, entry.Name())
+		if entry.Type()&os.ModeSymlink != 0 {
+			fi, err := os.Stat(pathname) // follow the link
+			if err != nil {
+				return nil, err
+			}
+			if !fi.Mode().IsRegular() {
+				continue
+			}
+		} else if !entry.Type().IsRegular() {
+			continue
+		}
+		sections, err := c.parseFile(pathname, stats)
+		if err != nil {
+			return nil, err
+		}
+		mergeSections(conf, sections)
+	}
+	return conf, nil
+}
@@ -0,0 +1,71 @@
+package goconf
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// envImport is a flat KEY=value file whose pairs are injected into a section.
+type envImport struct {
+	pathname string
+	section  string
+}
+
+// ImportEnvFile mutates a new Config data structure so that the key-value
+// pairs of pathname, a flat `.env` style file of KEY=value lines without
+// sections, are injected into section, replacing any values of the same keys.
+// Blank lines and lines beginning with `#` are ignored, an `export ` prefix is
+// allowed and discarded, and a value wrapped in matching single or double
+// quotes has those quotes removed.  The file is read again each time the
+// configuration is, and it is an error for it not to exist.  When specified
+// more than once, files are imported in the order given.
+func ImportEnvFile(pathname, section string) func(*Config) error {
+	return func(c *Config) error {
+		if section == "" {
+			return fmt.Errorf("section name must not be empty")
+		}
+		c.envImports = append(c.envImports, envImport{pathname: pathname, section: section})
+		return nil
+	}
+}
+
+// parseEnvFile returns the key-value pairs of the flat KEY=value file at
+// pathname as a section, tallying what it reads in stats.
+func (c *Config) parseEnvFile(pathname string, stats *ParseStats) (*section, error) {
+	fh, err := c.openFile(pathname)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	stats.Files++
+	stats.stamp(pathname)
+
+	sect := newSection()
+	buf := bufio.NewScanner(fh)
+	buf.Split(scanLines)
+	for lineNumber := 1; buf.Scan(); lineNumber++ {
+		line := strings.TrimSpace(buf.Text())
+		if len(line) == 0 {
+			continue
+		}
+		if line[0] == '#' {
+			stats.Comments++
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		equals := strings.IndexByte(line, '=')
+		if equals <= 0 {
+			return nil, fmt.Errorf("invalid env file line: %s:%d: [%s]", pathname, lineNumber, line)
+		}
+		key := c.keyName(strings.TrimSpace(line[:equals]))
+		sect.set(key, trimQuotes(strings.TrimSpace(line[equals+1:])), origin{file: pathname, line: lineNumber})
+	}
+	if err := buf.Err(); err != nil {
+		return nil, err
+	}
+	if c.recordBlocks {
+		sect.recordBlock()
+	}
+	return sect, nil
+}
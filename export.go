@@ -0,0 +1,161 @@
+package goconf
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// ToTOML returns the configuration rendered as a TOML document.  Each section
+// becomes a TOML table, and each key becomes a string-valued entry in that
+// table.  Sections and keys are emitted in sorted order so the output is
+// deterministic.
+func (c *Config) ToTOML() ([]byte, error) {
+	conf, err := c.sections()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for i, name := range sortedSectionNames(conf) {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		fmt.Fprintf(&buf, "[%s]\n", tomlKey(name))
+		section := conf[name].values
+		for _, key := range sortedKeys(section) {
+			fmt.Fprintf(&buf, "%s = %s\n", tomlKey(key), tomlString(section[key]))
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// tomlKey returns key as a bare TOML key when possible, or as a quoted key
+// otherwise.
+func tomlKey(key string) string {
+	if key == "" {
+		return `""`
+	}
+	for i := 0; i < len(key); i++ {
+		b := key[i]
+		if !('A' <= b && b <= 'Z' || 'a' <= b && b <= 'z' || '0' <= b && b <= '9' || b == '_' || b == '-') {
+			return tomlString(key)
+		}
+	}
+	return key
+}
+
+// tomlString returns s as a TOML basic string.
+func tomlString(s string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\r':
+			buf.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&buf, `\u%04X`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// ToYAML returns the configuration rendered as a YAML document, mapping each
+// section name to a mapping of its keys and values.  Values are always emitted
+// as double-quoted strings so they survive the trip without YAML reinterpreting
+// them as numbers, booleans, or nulls, and sections and keys are emitted in
+// sorted order so the output is deterministic.
+func (c *Config) ToYAML() ([]byte, error) {
+	conf, err := c.sections()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for _, name := range sortedSectionNames(conf) {
+		section := conf[name].values
+		if len(section) == 0 {
+			fmt.Fprintf(&buf, "%s: {}\n", strconv.Quote(name))
+			continue
+		}
+		fmt.Fprintf(&buf, "%s:\n", strconv.Quote(name))
+		for _, key := range sortedKeys(section) {
+			// Go's quoted string escapes are a subset of those accepted by
+			// YAML double-quoted scalars.
+			fmt.Fprintf(&buf, "  %s: %s\n", strconv.Quote(key), strconv.Quote(section[key]))
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// Hash returns the hexadecimal SHA-256 digest of the section names, keys, and
+// values of the configuration, after normalization and after every source is
+// merged.  Sections and keys are hashed in sorted order, so configurations
+// holding the same settings hash identically regardless of the order of their
+// sections and keys, while comments, whitespace, and the origins of values do
+// not affect the result.
+func (c *Config) Hash() (string, error) {
+	conf, err := c.sections()
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, name := range sortedSectionNames(conf) {
+		// Each string is prefixed with its length and each section with
+		// its number of keys, so the input decodes in only one way, and
+		// no choice of names, keys, and values can produce the same
+		// input as another.
+		section := conf[name].values
+		hashString(h, name)
+		fmt.Fprintf(h, "%d.", len(section))
+		for _, key := range sortedKeys(section) {
+			hashString(h, key)
+			hashString(h, section[key])
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashString writes s to w prefixed by its length.
+func hashString(w io.Writer, s string) {
+	fmt.Fprintf(w, "%d:%s", len(s), s)
+}
+
+// sortedSectionNames returns the section names of conf in sorted order.
+func sortedSectionNames(conf map[string]*section) []string {
+	names := make([]string, 0, len(conf))
+	for name := range conf {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sortedKeys returns the keys of dict in sorted order.
+func sortedKeys(dict map[string]string) []string {
+	keys := make([]string, 0, len(dict))
+	for key := range dict {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,77 @@
+package goconf
+
+import "testing"
+
+func TestHashDistinguishesConfigurations(t *testing.T) {
+	pairs := []struct {
+		name string
+		a, b func(*testing.T) *Config
+	}{
+		{
+			"key named like a section marker",
+			fileConfig("[A]\n[ = General\n"),
+			fileConfig("[ = General\n[A]\nk = !unset\n"),
+		},
+		{
+			"JSON key named like a section marker",
+			jsonConfig(`{"A":{"[":"B"}}`),
+			jsonConfig(`{"A":{},"B":{}}`),
+		},
+		{
+			"value that looks like a key",
+			fileConfig("[A]\nk = 1:v\n"),
+			fileConfig("[A]\nk = 1\nv = 1\n"),
+		},
+	}
+	for _, tc := range pairs {
+		a, b := tc.a(t), tc.b(t)
+		ha, err := a.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		hb, err := b.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ha == hb {
+			t.Errorf("%s: both hash to %s", tc.name, ha)
+		}
+	}
+}
+
+func TestHashIgnoresOrder(t *testing.T) {
+	a, b := fileConfig("[a]\nx = 1\ny = 2\n[b]\nz = 3\n")(t), fileConfig("[b]\nz = 3\n[a]\ny = 2\nx = 1\n")(t)
+	ha, err := a.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hb, err := b.Hash(); err != nil || ha != hb {
+		t.Errorf("GOT: %s, %v; WANT: %s", hb, err, ha)
+	}
+}
+
+// fileConfig returns a function creating a Config from a file holding
+// contents, closed when the test ends.
+func fileConfig(contents string) func(*testing.T) *Config {
+	return func(t *testing.T) *Config {
+		c, err := New(writeTestFile(t, contents))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+}
+
+// jsonConfig returns a function creating a Config from the JSON document
+// data, closed when the test ends.
+func jsonConfig(data string) func(*testing.T) *Config {
+	return func(t *testing.T) *Config {
+		c, err := NewJSON([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+}
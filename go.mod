@@ -1,3 +1,5 @@
 module github.com/karrick/goconf
 
+go 1.17
+
 require github.com/karrick/congomap/v2 v2.6.1
@@ -2,13 +2,19 @@ package goconf
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"regexp"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
-
-	congomap "github.com/karrick/congomap/v2"
+	"unicode"
 )
 
 // DefaultSectionName is the name of the default config section.  Any key-value
@@ -16,11 +22,84 @@ import (
 // name.
 const DefaultSectionName = "General"
 
+// ErrSectionNotFound is returned, wrapped with the section name, when a
+// requested section is not in the configuration.  Use errors.Is to test for it.
+var ErrSectionNotFound = errors.New("section not found")
+
+// ErrKeyNotFound is returned, wrapped with the section and key names, when a
+// requested key is not in its section.  Use errors.Is to test for it.
+var ErrKeyNotFound = errors.New("key not found")
+
+// errClosed is returned by methods that replace the section cache of a Config
+// that has been closed.
+var errClosed = errors.New("config is closed")
+
 // Config is a data structure used to maintain an applications configuration.
 type Config struct {
 	pathname string
-	cgm      congomap.Congomap
-	ttl      time.Duration
+	dir      string // directory of drop-in files, when created by NewDir
+	load     func(*ParseStats) (map[string]*section, error)
+	options
+
+	cacheLock sync.RWMutex // guards cache and ttl, which SetTTL replaces
+	cache     cache
+	ttl       time.Duration
+	closed    bool // set by Close, after which the cache is not replaced
+
+	statsLock sync.Mutex // guards stats, which every parse replaces
+	stats     *ParseStats
+
+	overrideLock sync.RWMutex
+	overrides    map[string]*section // set by Override, keyed by section name
+}
+
+// options holds the settings of a Config made by its setters, apart from the
+// TTL.
+type options struct {
+	env        string
+	envImports []envImport
+	backend    BackendKind
+	timeout    time.Duration
+
+	// secret resolution
+	resolver     func(string) (string, error)
+	secretPrefix string
+
+	// warnUnresolved is called with values that look like unexpanded
+	// references.
+	warnUnresolved func(section, key, value string)
+
+	// parsing options
+	sectionNormalizer     func(string) string
+	keyNormalizer         func(string) string
+	defaultSection        string // holds keys that appear before any section header
+	trimQuotes            bool
+	preserveTrailingSpace bool
+	unsetMarker           string
+	noUnsetMarker         bool
+	onInvalidLine         func(string, int) error
+	requireSection        bool
+	noImplicitDefault     bool
+	recordBlocks          bool
+
+	// securePermissions refuses files accessible by group or others.
+	securePermissions bool
+
+	// resolvePaths makes GetPath resolve relative paths against the directory
+	// of the configuration.
+	resolvePaths bool
+
+	// flatKeySeparator joins section names and keys in FlatKeys.
+	flatKeySeparator string
+
+	// header is written as comments before any written configuration.
+	header []string
+
+	// fileLock makes AppendSection lock the configuration file.
+	fileLock bool
+
+	// deprecations maps "section.key" names to messages, for Deprecated.
+	deprecations map[string]string
 }
 
 // ConfigSetter is a function that mutates a new Config instance during
@@ -29,21 +108,37 @@ type ConfigSetter func(*Config) error
 
 // New returns a new Config data structure.
 func New(pathname string, setters ...ConfigSetter) (*Config, error) {
-	var err error
-
 	c := &Config{pathname: pathname}
+	c.load = c.loadFile
+	return c.init(setters)
+}
 
-	for _, setter := range setters {
-		if err := setter(c); err != nil {
-			return nil, err
-		}
+// NewEmpty returns a new Config data structure with no backing file, holding
+// only an empty default section.  It panics if any setter returns an error,
+// which for the setters of this package happens only when given invalid
+// arguments.
+func NewEmpty(setters ...ConfigSetter) *Config {
+	c := &Config{}
+	c.load = func(*ParseStats) (map[string]*section, error) {
+		return map[string]*section{c.defaultSection: newSection()}, nil
 	}
+	c, err := c.init(setters)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// init applies setters to a new Config whose source has already been set, then
+// creates its section cache.
+func (c *Config) init(setters []ConfigSetter) (*Config, error) {
+	var err error
 
-	cgms := []congomap.Setter{congomap.Lookup(c.lookupSection())}
-	if c.ttl > 0 {
-		cgms = append(cgms, congomap.TTL(c.ttl))
+	if err = c.configure(setters); err != nil {
+		return nil, err
 	}
-	c.cgm, err = congomap.NewSyncAtomicMap(cgms...) // relatively few config sections
+
+	c.cache, err = newCache(c.backend, c.lookupSection(), c.ttl)
 	if err != nil {
 		return nil, err
 	}
@@ -51,6 +146,30 @@ func New(pathname string, setters ...ConfigSetter) (*Config, error) {
 	return c, nil
 }
 
+// configure applies setters to c, then fills in the defaults of any options
+// they left unset.
+func (c *Config) configure(setters []ConfigSetter) error {
+	for _, setter := range setters {
+		if err := setter(c); err != nil {
+			return err
+		}
+	}
+	if c.defaultSection == "" {
+		c.defaultSection = DefaultSectionName
+	}
+	c.defaultSection = c.sectionName(c.defaultSection)
+	if c.secretPrefix == "" {
+		c.secretPrefix = DefaultSecretPrefix
+	}
+	if c.unsetMarker == "" && !c.noUnsetMarker {
+		c.unsetMarker = DefaultUnsetMarker
+	}
+	if c.flatKeySeparator == "" {
+		c.flatKeySeparator = DefaultFlatKeySeparator
+	}
+	return nil
+}
+
 // TTL mutates a new Config data structure to control how often values are
 // refreshed.
 func TTL(ttl time.Duration) func(*Config) error {
@@ -63,71 +182,1159 @@ func TTL(ttl time.Duration) func(*Config) error {
 	}
 }
 
+// Timeout mutates a new Config data structure to control how long a single
+// fetch of a remote configuration may take.  It has no effect for
+// configurations read from a file.
+func Timeout(timeout time.Duration) func(*Config) error {
+	return func(c *Config) error {
+		if timeout <= 0 {
+			return fmt.Errorf("timeout must be greater than 0")
+		}
+		c.timeout = timeout
+		return nil
+	}
+}
+
+// DefaultSection mutates a new Config data structure to store key-value pairs
+// that appear before any section header in the section called name, rather than
+// in the section called DefaultSectionName.
+func DefaultSection(name string) func(*Config) error {
+	return func(c *Config) error {
+		if name == "" {
+			return fmt.Errorf("default section name must not be empty")
+		}
+		c.defaultSection = name
+		return nil
+	}
+}
+
+// DefaultFlatKeySeparator joins section names and keys in the result of
+// FlatKeys when no FlatKeySeparator is specified.
+const DefaultFlatKeySeparator = "."
+
+// FlatKeySeparator mutates a new Config data structure to join section names
+// and keys in the result of FlatKeys with sep rather than with
+// DefaultFlatKeySeparator.
+func FlatKeySeparator(sep string) func(*Config) error {
+	return func(c *Config) error {
+		if sep == "" {
+			return fmt.Errorf("flat key separator must not be empty")
+		}
+		c.flatKeySeparator = sep
+		return nil
+	}
+}
+
+// EnvSuffix mutates a new Config data structure so that after reading its
+// configuration file, it also reads an optional environment-specific overlay
+// file whose name is formed by inserting env before the file extension, and
+// values in the overlay replace those in the base file.  For instance, with an
+// env of "prod", "app.conf" is overlaid by "app.prod.conf".  When env is empty,
+// the value of the APP_ENV environment variable is used instead, and when that
+// is also empty no overlay is read.  It is not an error for the overlay file
+// not to exist.
+func EnvSuffix(env string) func(*Config) error {
+	return func(c *Config) error {
+		if env == "" {
+			env = os.Getenv("APP_ENV")
+		}
+		c.env = env
+		return nil
+	}
+}
+
+// DefaultSecretPrefix is the prefix marking a value as a reference to be
+// resolved by the SecretResolver when no SecretPrefix is specified.
+const DefaultSecretPrefix = "@secret:"
+
+// SecretResolver mutates a new Config data structure so that each value
+// beginning with the secret prefix is replaced by the result of calling
+// resolver with the remainder of the value.  For instance, with the default
+// prefix, `password = @secret:db/password` calls resolver with "db/password".
+// Secrets are resolved when a section is loaded into the cache rather than
+// when the file is parsed, so they are held no longer than the TTL, and an
+// error returned by resolver is returned by the accessor that loaded the
+// section.  Methods that read all sections at once, such as ToTOML, return
+// references unresolved.
+func SecretResolver(resolver func(ref string) (string, error)) func(*Config) error {
+	return func(c *Config) error {
+		if resolver == nil {
+			return fmt.Errorf("secret resolver must not be nil")
+		}
+		c.resolver = resolver
+		return nil
+	}
+}
+
+// SecretPrefix mutates a new Config data structure to change the prefix that
+// marks a value as a reference for the SecretResolver from DefaultSecretPrefix
+// to prefix.
+func SecretPrefix(prefix string) func(*Config) error {
+	return func(c *Config) error {
+		if prefix == "" {
+			return fmt.Errorf("secret prefix must not be empty")
+		}
+		c.secretPrefix = prefix
+		return nil
+	}
+}
+
+// DefaultUnsetMarker is the value that removes a key when no UnsetMarker is
+// specified.
+const DefaultUnsetMarker = "!unset"
+
+// UnsetMarker mutates a new Config data structure to change the value that
+// removes a key from DefaultUnsetMarker to marker.  A key whose value is the
+// marker, as in `key = !unset`, is removed from the configuration along with
+// any value it was given earlier in the same file or by a source beneath it,
+// which lets an overlay such as an EnvSuffix file or an ImportEnvFile file
+// suppress an inherited key.  An empty marker disables removal so that every
+// value is taken literally.
+func UnsetMarker(marker string) func(*Config) error {
+	return func(c *Config) error {
+		c.unsetMarker = marker
+		c.noUnsetMarker = marker == ""
+		return nil
+	}
+}
+
+// ResolvePaths mutates a new Config data structure so GetPath resolves a
+// relative path against the directory holding the configuration file, or
+// against the directory given to NewDir.  It has no effect for a Config
+// without a configuration file or directory.
+func ResolvePaths() func(*Config) error {
+	return func(c *Config) error {
+		c.resolvePaths = true
+		return nil
+	}
+}
+
+// RequireSecurePermissions mutates a new Config data structure so that, like
+// OpenSSH does for private keys, it refuses to read a configuration file that
+// is readable, writable, or executable by its group or by others.  The check
+// applies to every file the Config reads, and is skipped on Windows, where
+// file mode bits do not control access.
+func RequireSecurePermissions() func(*Config) error {
+	return func(c *Config) error {
+		c.securePermissions = true
+		return nil
+	}
+}
+
+// SectionNormalizer mutates a new Config data structure so that every section
+// name is passed through normalizer, both when the configuration is read and
+// when a section is requested, so requests match sections stored in normalized
+// form.  For instance, strings.ToLower makes section names case-insensitive.
+func SectionNormalizer(normalizer func(string) string) func(*Config) error {
+	return func(c *Config) error {
+		if normalizer == nil {
+			return fmt.Errorf("section normalizer must not be nil")
+		}
+		c.sectionNormalizer = normalizer
+		return nil
+	}
+}
+
+// KeyNormalizer mutates a new Config data structure so that every key is
+// passed through normalizer, both when the configuration is read and when a
+// key is requested, so requests match keys stored in normalized form.  Keys in
+// the map returned by Section are in normalized form.
+func KeyNormalizer(normalizer func(string) string) func(*Config) error {
+	return func(c *Config) error {
+		if normalizer == nil {
+			return fmt.Errorf("key normalizer must not be nil")
+		}
+		c.keyNormalizer = normalizer
+		return nil
+	}
+}
+
+// CaseInsensitiveSections mutates a new Config data structure so that section
+// names are case-insensitive, independently of key names.  It is shorthand for
+// SectionNormalizer(strings.ToLower), so the last of the two setters applied
+// takes effect.
+func CaseInsensitiveSections() func(*Config) error {
+	return SectionNormalizer(strings.ToLower)
+}
+
+// CaseInsensitiveKeys mutates a new Config data structure so that keys are
+// case-insensitive, independently of section names.  It is shorthand for
+// KeyNormalizer(strings.ToLower), so the last of the two setters applied takes
+// effect, and keys in the map returned by Section are in lower case.
+func CaseInsensitiveKeys() func(*Config) error {
+	return KeyNormalizer(strings.ToLower)
+}
+
+// sectionName returns name in normalized form.
+func (o *options) sectionName(name string) string {
+	if o.sectionNormalizer != nil {
+		return o.sectionNormalizer(name)
+	}
+	return name
+}
+
+// keyName returns key in normalized form.
+func (o *options) keyName(key string) string {
+	if o.keyNormalizer != nil {
+		return o.keyNormalizer(key)
+	}
+	return key
+}
+
+// OnInvalidLine mutates a new Config data structure so that, rather than
+// failing, parsing calls handler with each line that is neither a section
+// header nor a key-value pair, along with its line number.  When handler
+// returns nil the line is skipped, and when it returns an error parsing stops
+// and that error is returned.  A skipped malformed section header does not
+// begin a new section.  Without a handler, the first such line is an error.
+func OnInvalidLine(handler func(line string, num int) error) func(*Config) error {
+	return func(c *Config) error {
+		if handler == nil {
+			return fmt.Errorf("invalid line handler must not be nil")
+		}
+		c.onInvalidLine = handler
+		return nil
+	}
+}
+
+// unresolvedRe matches the `${NAME}` references of environment expansion and
+// the `%(name)s` references of interpolation.
+var unresolvedRe = regexp.MustCompile(`\$\{[^}]*\}|%\([^)]*\)s`)
+
+// WarnUnresolved mutates a new Config data structure so that, each time a
+// section is loaded into the cache, warn is called with every value of the
+// section that still contains a `${NAME}` or `%(name)s` reference after secrets
+// are resolved.  Such values usually show that a file was written for
+// expansion or interpolation that was never performed.  The values are still
+// returned unchanged.
+func WarnUnresolved(warn func(section, key, value string)) func(*Config) error {
+	return func(c *Config) error {
+		if warn == nil {
+			return fmt.Errorf("unresolved value warning function must not be nil")
+		}
+		c.warnUnresolved = warn
+		return nil
+	}
+}
+
+// RequireSection mutates a new Config data structure so that a key-value pair
+// appearing before the first section header is an error reporting its line
+// number, rather than being stored in the default section.
+func RequireSection() func(*Config) error {
+	return func(c *Config) error {
+		c.requireSection = true
+		return nil
+	}
+}
+
+// RecordSectionBlocks mutates a new Config data structure so that parsing
+// records the key-value pairs of each block of every section, where a block
+// begins at each section header, for SectionList.  Because this keeps a second
+// copy of every key-value pair, it is off by default, in which case only the
+// merged sections returned by Section are kept.
+func RecordSectionBlocks() func(*Config) error {
+	return func(c *Config) error {
+		c.recordBlocks = true
+		return nil
+	}
+}
+
+// NoImplicitDefault mutates a new Config data structure so the default section
+// exists only when some source places keys in it.  By default it always
+// exists, even when empty.  Without keys in it, requesting the default
+// section returns ErrSectionNotFound, and it is neither counted by
+// SectionCount nor written by Reader.
+func NoImplicitDefault() func(*Config) error {
+	return func(c *Config) error {
+		c.noImplicitDefault = true
+		return nil
+	}
+}
+
+// TrimQuotes mutates a new Config data structure so a value that both begins
+// and ends with the same quote character, either `"` or `'`, has exactly those
+// two quote characters removed.  Everything between them is kept as it is,
+// except that a comment character inside the quotes still begins a comment
+// unless escaped with a backslash.  Values without matching outer quotes are
+// unchanged.
+func TrimQuotes() func(*Config) error {
+	return func(c *Config) error {
+		c.trimQuotes = true
+		return nil
+	}
+}
+
+// PreserveTrailingSpace mutates a new Config data structure so the whitespace
+// that ends a value, up to the end of the line or the start of a comment on
+// the same line, is kept as part of the value rather than trimmed.  Without
+// it, and for compatibility by default, that whitespace is removed.  Keys,
+// section names, and the whitespace between the equals sign and the value are
+// trimmed either way, and a value cannot be made of whitespace alone.  Values
+// with trailing whitespace cannot be written by SaveOverlay or Reader, since
+// they would not read back unchanged without this setter.  When TrimQuotes is
+// also used, quotes are only removed from values that end with a quote.
+func PreserveTrailingSpace() func(*Config) error {
+	return func(c *Config) error {
+		c.preserveTrailingSpace = true
+		return nil
+	}
+}
+
 func (c *Config) lookupSection() func(string) (interface{}, error) {
 	return func(section string) (interface{}, error) {
-		conf, err := parseConfigFile(c.pathname)
+		conf, err := c.sections()
 		if err != nil {
 			return nil, err
 		}
 		sect, ok := conf[section]
 		if !ok {
-			return nil, fmt.Errorf("no such section: %q", section)
+			return nil, fmt.Errorf("%w: %q", ErrSectionNotFound, section)
+		}
+		if err = c.finishSection(section, sect); err != nil {
+			return nil, err
 		}
 		return sect, nil
 	}
 }
 
+// finishSection resolves the secret references in sect, the section called
+// name, including those in each of its blocks, and reports any values still
+// holding unresolved references.
+func (c *Config) finishSection(name string, sect *section) error {
+	if c.resolver != nil {
+		secrets := make(map[string]string) // each reference is resolved once
+		if err := c.resolveSecrets(name, sect.values, sect.keys, secrets); err != nil {
+			return err
+		}
+		for _, block := range sect.blocks {
+			if err := c.resolveSecrets(name, block, sortedKeys(block), secrets); err != nil {
+				return err
+			}
+		}
+	}
+	if c.warnUnresolved != nil {
+		for _, key := range sect.keys {
+			if value := sect.values[key]; unresolvedRe.MatchString(value) {
+				c.warnUnresolved(name, key, value)
+			}
+		}
+		for _, block := range sect.blocks {
+			for _, key := range sortedKeys(block) {
+				// A value in effect has already been reported.
+				if value := block[key]; value != sect.values[key] && unresolvedRe.MatchString(value) {
+					c.warnUnresolved(name, key, value)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// resolveSecrets replaces each secret reference among the values of keys, in
+// the section called name, with the secret it refers to.  Secrets already in
+// secrets are reused, and those newly resolved are added to it.
+func (c *Config) resolveSecrets(name string, values map[string]string, keys []string, secrets map[string]string) error {
+	for _, key := range keys {
+		value := values[key]
+		if !strings.HasPrefix(value, c.secretPrefix) {
+			continue
+		}
+		secret, ok := secrets[value]
+		if !ok {
+			var err error
+			secret, err = c.resolver(value[len(c.secretPrefix):])
+			if err != nil {
+				return fmt.Errorf("cannot resolve secret for key %q in section %q: %w", key, name, err)
+			}
+			secrets[value] = secret
+		}
+		values[key] = secret
+	}
+	return nil
+}
+
+// sections returns all sections of the configuration, bypassing the cache so
+// the result reflects a single consistent parse.
+func (c *Config) sections() (map[string]*section, error) {
+	var stats ParseStats
+	conf, err := c.merged(&stats)
+	if err != nil {
+		return nil, err
+	}
+	if c.unsetMarker != "" {
+		// Removal waits until every source is merged, so a marker in a
+		// later source removes values from the sources before it.
+		for _, sect := range conf {
+			for _, key := range append([]string(nil), sect.keys...) {
+				if sect.values[key] == c.unsetMarker {
+					sect.delete(key)
+				}
+			}
+			blocks := sect.blocks[:0]
+			for _, block := range sect.blocks {
+				for key, value := range block {
+					if value == c.unsetMarker {
+						delete(block, key)
+					}
+				}
+				if len(block) > 0 {
+					blocks = append(blocks, block)
+				}
+			}
+			sect.blocks = blocks
+		}
+	}
+	if c.noImplicitDefault {
+		// After removing unset keys, so a default section holding only
+		// unset markers is dropped as well.
+		if sect, ok := conf[c.defaultSection]; ok && len(sect.keys) == 0 {
+			delete(conf, c.defaultSection)
+		}
+	}
+
+	stats.Sections = len(conf)
+	for _, sect := range conf {
+		stats.Keys += len(sect.keys)
+	}
+	stats.Parsed = time.Now()
+	c.statsLock.Lock()
+	c.stats = &stats
+	c.statsLock.Unlock()
+	return conf, nil
+}
+
+// merged returns all sections of the configuration with every source merged,
+// tallying what it reads in stats, but with unset markers still in place.
+func (c *Config) merged(stats *ParseStats) (map[string]*section, error) {
+	conf, err := c.load(stats)
+	if err != nil {
+		return nil, err
+	}
+	for _, imp := range c.envImports {
+		sect, err := c.parseEnvFile(imp.pathname, stats)
+		if err != nil {
+			return nil, err
+		}
+		mergeSections(conf, map[string]*section{c.sectionName(imp.section): sect})
+	}
+	return conf, nil
+}
+
+// loadSection returns the named section from the cache, parsing the
+// configuration when it is not already cached, with any overrides applied.
+func (c *Config) loadSection(name string) (*section, error) {
+	name = c.sectionName(name)
+	value, err := c.sectionCache().LoadStore(name)
+	var sect *section
+	if err == nil {
+		sect = value.(*section)
+	}
+	return c.overridden(name, sect, err)
+}
+
 // Section returns a map of the key-value pairs for a specified section of the
 // configuration file.  The default section name is stored in
-// `DefaultSectionName`.
+// `DefaultSectionName`, unless changed with the DefaultSection setter.
 func (c *Config) Section(section string) (map[string]string, error) {
-	dict, err := c.cgm.LoadStore(section)
+	sect, err := c.loadSection(section)
+	if err != nil {
+		return nil, err
+	}
+	return sect.values, nil
+}
+
+// Default returns a map of the key-value pairs of the default section, which
+// holds any keys that appear before the first section header.  It is the same
+// as calling Section with the default section name, whether that is
+// `DefaultSectionName` or a name set with the DefaultSection setter.
+func (c *Config) Default() (map[string]string, error) {
+	return c.Section(c.defaultSection)
+}
+
+// SectionList returns the key-value pairs of each block of the specified
+// section, in the order the blocks appear, so a section whose header is
+// repeated, such as several "[server]" blocks, may be read as a list rather
+// than as the single merged map returned by Section.  When a key repeats
+// within one block, the block holds its last value.  Blocks from layered
+// sources follow those of the sources they are layered on, and a source that
+// has no blocks, such as an ImportEnvFile file or a NewJSON document,
+// contributes each section as a single block.  Secret references in every
+// block are resolved as they are for Section.  An unset marker removes its key
+// from its own block only, and overrides do not apply.  Blocks are only
+// recorded when the Config was created with RecordSectionBlocks, and without
+// it SectionList returns an error.
+func (c *Config) SectionList(name string) ([]map[string]string, error) {
+	if !c.recordBlocks {
+		return nil, fmt.Errorf("cannot list blocks of section %q: section blocks are not recorded without RecordSectionBlocks", name)
+	}
+	sect, err := c.sectionCache().LoadStore(c.sectionName(name)) // without overrides
+	if err != nil {
+		return nil, err
+	}
+	return append([]map[string]string(nil), sect.(*section).blocks...), nil
+}
+
+// SectionsMatching returns the key-value pairs of every section of the
+// configuration file whose name matches the regular expression pattern, keyed
+// by section name.  All sections are read from a single parse of the file.
+func (c *Config) SectionsMatching(pattern string) (map[string]map[string]string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid section pattern %q: %s", pattern, err)
+	}
+	conf, err := c.sections()
 	if err != nil {
 		return nil, err
 	}
-	return dict.(map[string]string), nil
+	matches := make(map[string]map[string]string)
+	for name, sect := range conf {
+		if re.MatchString(name) {
+			matches[name] = sect.values
+		}
+	}
+	return matches, nil
+}
+
+// FlatKeys returns every key-value pair of the configuration in a single map,
+// with each key prefixed by the name of its section and the flat key
+// separator, as in "section.key".  The separator defaults to
+// DefaultFlatKeySeparator and may be changed with FlatKeySeparator.  All
+// sections are read from a single parse of the file.
+func (c *Config) FlatKeys() (map[string]string, error) {
+	conf, err := c.sections()
+	if err != nil {
+		return nil, err
+	}
+	flat := make(map[string]string)
+	for name, sect := range conf {
+		for key, value := range sect.values {
+			flat[name+c.flatKeySeparator+key] = value
+		}
+	}
+	return flat, nil
+}
+
+// Audit reports which required keys are missing from the configuration.  The
+// requirements map section names to the keys each must have, and the result
+// maps every section named in requirements to the keys it lacks, in the order
+// given.  A fully satisfied section maps to an empty slice, and every
+// required key of a missing section is reported missing.  All sections are
+// read from a single parse of the file.
+func (c *Config) Audit(requirements map[string][]string) (map[string][]string, error) {
+	conf, err := c.sections()
+	if err != nil {
+		return nil, err
+	}
+	report := make(map[string][]string, len(requirements))
+	for name, keys := range requirements {
+		missing := []string{}
+		sect := conf[c.sectionName(name)]
+		for _, key := range keys {
+			if sect != nil {
+				if _, ok := sect.values[c.keyName(key)]; ok {
+					continue
+				}
+			}
+			missing = append(missing, key)
+		}
+		report[name] = missing
+	}
+	return report, nil
+}
+
+// SectionCount returns the number of sections in the configuration, including
+// the default section, which is present unless NoImplicitDefault is used.
+func (c *Config) SectionCount() (int, error) {
+	conf, err := c.sections()
+	if err != nil {
+		return 0, err
+	}
+	return len(conf), nil
+}
+
+// KeyCount returns the number of keys in the specified section.
+func (c *Config) KeyCount(section string) (int, error) {
+	sect, err := c.loadSection(section)
+	if err != nil {
+		return 0, err
+	}
+	return len(sect.keys), nil
+}
+
+// ParseStats describes a single parse of the configuration.  More fields may
+// be added in the future.
+type ParseStats struct {
+	Sections int       // number of sections, after every source is merged
+	Keys     int       // number of keys in all sections
+	Comments int       // number of lines holding nothing but a comment
+	Files    int       // number of files read, including overlays and imports
+	Parsed   time.Time // when the parse completed
+
+	stamps []fileStamp // every file read, for Changed
+}
+
+// Stats returns statistics describing the most recent parse of the
+// configuration, parsing it first when it has not been parsed yet.  Because
+// sections are cached, the statistics reflect the parse that last filled the
+// cache, or any later parse made by a method such as SectionCount that reads
+// the configuration as a whole.
+func (c *Config) Stats() (ParseStats, error) {
+	c.statsLock.Lock()
+	stats := c.stats
+	c.statsLock.Unlock()
+	if stats != nil {
+		return *stats, nil
+	}
+	if _, err := c.sections(); err != nil {
+		return ParseStats{}, err
+	}
+	c.statsLock.Lock()
+	defer c.statsLock.Unlock()
+	return *c.stats, nil
+}
+
+// KeyValue is a single key-value pair from a configuration section.
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// SectionOrdered returns the key-value pairs for a specified section of the
+// configuration file in the order their keys first appear in the file.  Unlike
+// the map returned by Section, the result has a deterministic order.
+func (c *Config) SectionOrdered(section string) ([]KeyValue, error) {
+	sect, err := c.loadSection(section)
+	if err != nil {
+		return nil, err
+	}
+	return sect.ordered(), nil
 }
 
 // Close frees and releases resources consumed by Config data structure when no
-// longer needed.
+// longer needed.  Closing a Config that is already closed does nothing and
+// returns nil, so Close may be deferred even when Run also closes c.
 func (c *Config) Close() error {
-	return c.cgm.Close()
+	c.cacheLock.Lock()
+	if c.closed {
+		c.cacheLock.Unlock()
+		return nil
+	}
+	c.closed = true
+	cache := c.cache
+	c.cacheLock.Unlock()
+	return cache.Close()
 }
 
-func parseConfigFile(pathname string) (conf map[string]map[string]string, err error) {
-	fh, err := os.Open(pathname)
+// Run blocks until ctx is done and then closes c, returning the error from
+// Close, so the lifetime of c may be tied to a context, for instance as one of
+// the goroutines of an errgroup.Group.  Sections are refreshed on access,
+// according to the TTL, whether or not Run is used.  Since Close may be called
+// more than once, a deferred Close after Run is harmless.
+func (c *Config) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return c.Close()
+}
+
+// SetTTL changes how often values are refreshed, like the TTL setter does for
+// a new Config.  The section cache is replaced, so every section is read again
+// on its next access.  It returns an error once c is closed.
+func (c *Config) SetTTL(ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("ttl must be greater than 0")
+	}
+	return c.resetCache(ttl)
+}
+
+// Reset discards every cached section and every override, so the next access
+// of each section reflects the configuration as it is then.  It returns an
+// error once c is closed.
+func (c *Config) Reset() error {
+	c.overrideLock.Lock()
+	c.overrides = nil
+	c.overrideLock.Unlock()
+	return c.resetCache(0)
+}
+
+// resetCache replaces the section cache of c with an empty one.  When ttl is
+// greater than 0 it becomes the TTL of the new cache; otherwise the current TTL
+// is kept.
+func (c *Config) resetCache(ttl time.Duration) error {
+	c.cacheLock.Lock()
+	if c.closed {
+		c.cacheLock.Unlock()
+		return errClosed
+	}
+	if ttl <= 0 {
+		ttl = c.ttl
+	}
+	cache, err := newCache(c.backend, c.lookupSection(), ttl)
 	if err != nil {
+		c.cacheLock.Unlock()
+		return err
+	}
+	old := c.cache
+	c.cache, c.ttl = cache, ttl
+	c.cacheLock.Unlock()
+	return old.Close()
+}
+
+// sectionCache returns the current section cache.
+func (c *Config) sectionCache() cache {
+	c.cacheLock.RLock()
+	defer c.cacheLock.RUnlock()
+	return c.cache
+}
+
+// section holds the key-value pairs of a single config section, along with the
+// order in which its keys first appeared and where each value came from.
+type section struct {
+	values  map[string]string
+	keys    []string
+	origins map[string]origin
+	comment string // trailing comment of the section header
+
+	// blocks holds the key-value pairs of each block of the section, in
+	// order, when RecordSectionBlocks is used.
+	blocks []map[string]string
+}
+
+// origin is the file and line a value was read from.  Values that did not come
+// from a file have the zero origin.
+type origin struct {
+	file string
+	line int
+}
+
+func newSection() *section {
+	return &section{values: make(map[string]string), origins: make(map[string]origin)}
+}
+
+// set stores value for key, read from at, recording the position of key the
+// first time it is seen.
+func (s *section) set(key, value string, at origin) {
+	if _, ok := s.values[key]; !ok {
+		s.keys = append(s.keys, key)
+	}
+	s.values[key] = value
+	s.origins[key] = at
+}
+
+// clone returns a copy of the section that shares no memory with it.
+func (s *section) clone() *section {
+	dup := newSection()
+	for _, key := range s.keys {
+		dup.set(key, s.values[key], s.origins[key])
+	}
+	dup.comment = s.comment
+	for _, block := range s.blocks {
+		dup.blocks = append(dup.blocks, copyBlock(block))
+	}
+	return dup
+}
+
+// recordBlock records all the key-value pairs of the section as its single
+// block, for sources that have no section headers to delimit blocks.
+func (s *section) recordBlock() {
+	if len(s.keys) > 0 {
+		s.blocks = []map[string]string{copyBlock(s.values)}
+	}
+}
+
+// copyBlock returns a copy of block that shares no memory with it.
+func copyBlock(block map[string]string) map[string]string {
+	copied := make(map[string]string, len(block))
+	for key, value := range block {
+		copied[key] = value
+	}
+	return copied
+}
+
+// delete removes key from the section.
+func (s *section) delete(key string) {
+	if _, ok := s.values[key]; !ok {
 		return
 	}
+	delete(s.values, key)
+	delete(s.origins, key)
+	for i, k := range s.keys {
+		if k == key {
+			s.keys = append(s.keys[:i], s.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// ordered returns the key-value pairs of the section in key order.
+func (s *section) ordered() []KeyValue {
+	pairs := make([]KeyValue, len(s.keys))
+	for i, key := range s.keys {
+		pairs[i] = KeyValue{Key: key, Value: s.values[key]}
+	}
+	return pairs
+}
+
+// loadFile parses the configuration file of c, followed by its environment
+// overlay file when one is configured and exists, tallying what it reads in
+// stats.
+func (c *Config) loadFile(stats *ParseStats) (map[string]*section, error) {
+	conf, err := c.parseFile(c.pathname, stats)
+	if err != nil {
+		return nil, err
+	}
+	if c.env != "" {
+		ext := filepath.Ext(c.pathname)
+		pathname := strings.TrimSuffix(c.pathname, ext) + "." + c.env + ext
+		overlay, err := c.parseFile(pathname, stats)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return nil, err
+			}
+			stats.stamp(pathname) // Changed notices when it appears
+		} else {
+			mergeSections(conf, overlay)
+		}
+	}
+	return conf, nil
+}
+
+// mergeSections merges the sections of overlay into conf, with values from
+// overlay replacing those already in conf.
+func mergeSections(conf, overlay map[string]*section) {
+	for name, sect := range overlay {
+		dst, ok := conf[name]
+		if !ok {
+			dst = newSection()
+			conf[name] = dst
+		}
+		if sect.comment != "" {
+			dst.comment = sect.comment
+		}
+		for _, block := range sect.blocks {
+			dst.blocks = append(dst.blocks, copyBlock(block)) // overlay may be reused
+		}
+		for _, key := range sect.keys {
+			dst.set(key, sect.values[key], sect.origins[key])
+		}
+	}
+}
+
+// ValidateFile parses the configuration file at pathname using the options of
+// c, such as its normalizers, TrimQuotes, OnInvalidLine, RequireSection, and
+// RequireSecurePermissions, and returns the first error found.  Only that file
+// is read, without any EnvSuffix overlay or ImportEnvFile files, and neither
+// c nor its cache is changed, so a candidate file may be checked before it
+// replaces the configuration file of c.
+func (c *Config) ValidateFile(pathname string) error {
+	_, err := c.parseFile(pathname, new(ParseStats))
+	return err
+}
+
+// parseFile parses the configuration file at pathname using the parsing
+// options of c, tallying what it reads in stats.
+func (c *Config) parseFile(pathname string, stats *ParseStats) (map[string]*section, error) {
+	fh, err := c.openFile(pathname)
+	if err != nil {
+		return nil, err
+	}
 	defer fh.Close()
-	buf := bufio.NewScanner(fh)
-	conf = make(map[string]map[string]string)
-	section := DefaultSectionName
-	sectionRe := regexp.MustCompile("^\\[([^\\]]+)\\]$")
-	keyValRe := regexp.MustCompile("^([^=]+)\\s*=\\s*(.+)$")
+	stats.Files++
+	stats.stamp(pathname)
+	return c.parse(fh, pathname, stats)
+}
+
+// openFile opens pathname for reading, first ensuring it is accessible only by
+// its owner when c requires secure permissions.
+func (c *Config) openFile(pathname string) (*os.File, error) {
+	fh, err := os.Open(pathname)
+	if err != nil {
+		return nil, err
+	}
+	if c.securePermissions && runtime.GOOS != "windows" { // Windows does not use mode bits for access
+		fi, err := fh.Stat()
+		if err != nil {
+			fh.Close()
+			return nil, err
+		}
+		if perm := fi.Mode().Perm(); perm&0077 != 0 {
+			fh.Close()
+			return nil, fmt.Errorf("insecure permissions on %q: %#o; must not be accessible by group or others", pathname, perm)
+		}
+	}
+	return fh, nil
+}
+
+// parse parses configuration read from r using the parsing options of c,
+// tallying comment lines in stats.  The name identifies the source of r in the
+// origin of each value.
+func (c *Config) parse(r io.Reader, name string, stats *ParseStats) (map[string]*section, error) {
+	conf := make(map[string]*section)
+	conf[c.defaultSection] = newSection() // always a default section
+
+	// A header alone does not create a section, so header comments are
+	// attached only to the sections that end up with keys.
+	comments := make(map[string]string)
+
+	// Each header begins a new block, created when its first key is read.
+	var block map[string]string
+
+	err := c.scan(r, stats, func(section, comment string, _ int) error {
+		if comment != "" {
+			comments[section] = comment
+		}
+		block = nil
+		return nil
+	}, func(section, key, value string, line int) error {
+		sect, ok := conf[section]
+		if !ok {
+			sect = newSection()
+			conf[section] = sect
+		}
+		if c.recordBlocks {
+			if block == nil {
+				block = make(map[string]string)
+				sect.blocks = append(sect.blocks, block)
+			}
+			block[key] = value
+		}
+		sect.set(key, value, origin{file: name, line: line})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for section, comment := range comments {
+		if sect, ok := conf[section]; ok {
+			sect.comment = comment
+		}
+	}
+	return conf, nil
+}
 
-	conf[section] = make(map[string]string) // always a default section
+// ParseStream parses configuration read from r, calling fn with each key-value
+// pair and the name of the section it belongs to, in the order they appear.
+// Unlike New, it never holds more than a line of the configuration in memory
+// at once, which makes it suitable for indexing very large files.  Parsing
+// stops at the first error, whether it is a line that cannot be parsed or an
+// error returned by fn, and that error is returned.  The default parsing
+// options are used.
+func ParseStream(r io.Reader, fn func(section, key, value string) error) error {
+	c := new(Config)
+	if err := c.configure(nil); err != nil {
+		return err
+	}
+	return c.scan(r, new(ParseStats), nil, func(section, key, value string, _ int) error {
+		return fn(section, key, value)
+	})
+}
 
-	for buf.Scan() {
-		line := buf.Text()
-		if comment := strings.IndexByte(line, ';'); comment >= 0 {
-			line = line[:comment]
+// ParseFile parses the configuration file at pathname once and returns its
+// sections, without the caching of a Config.  The setters are those of New,
+// and the result is what the Section method of a Config created by New with
+// the same setters would return for each section, including EnvSuffix
+// overlays, ImportEnvFile files, and resolved secrets.  Setters that only
+// affect caching, such as TTL, have no effect.
+func ParseFile(pathname string, setters ...ConfigSetter) (map[string]map[string]string, error) {
+	c := &Config{pathname: pathname}
+	c.load = c.loadFile
+	return c.parseAll(setters)
+}
+
+// Parse is like ParseFile, but parses the configuration read from r.  Because
+// r has no file name, an EnvSuffix setter has no effect.
+func Parse(r io.Reader, setters ...ConfigSetter) (map[string]map[string]string, error) {
+	c := new(Config)
+	c.load = func(stats *ParseStats) (map[string]*section, error) {
+		return c.parse(r, "", stats)
+	}
+	return c.parseAll(setters)
+}
+
+// parseAll applies setters to c, then loads and returns every section of its
+// configuration.
+func (c *Config) parseAll(setters []ConfigSetter) (map[string]map[string]string, error) {
+	if err := c.configure(setters); err != nil {
+		return nil, err
+	}
+	conf, err := c.sections()
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]map[string]string, len(conf))
+	for name, sect := range conf {
+		if err = c.finishSection(name, sect); err != nil {
+			return nil, err
+		}
+		result[name] = sect.values
+	}
+	return result, nil
+}
+
+// scan parses configuration read from r using the parsing options of c,
+// tallying comment lines in stats.  It calls onSection, when not nil, with the
+// name of each section header, the text of any comment following it on the
+// same line, and the line number of the header.  It calls onKey with each
+// key-value pair, the name of the section it belongs to, and the line number
+// it was read from.
+func (c *Config) scan(r io.Reader, stats *ParseStats, onSection func(section, comment string, line int) error, onKey func(section, key, value string, line int) error) error {
+	buf := bufio.NewScanner(r)
+	buf.Split(scanLines)
+	section := c.defaultSection
+	var sawHeader bool
+	sectionRe := regexp.MustCompile("^\\[([^\\]]+)\\](.*)$")
+	keyValRe := regexp.MustCompile("^([^=]*[^=\\s])\\s*=\\s*(.+)$")
+
+	for lineNumber := 1; buf.Scan(); lineNumber++ {
+		raw := buf.Text()
+		line := raw
+		if lineNumber == 1 {
+			if encoding := unsupportedBOM(line); encoding != "" {
+				return fmt.Errorf("unsupported encoding: %s BOM detected; expected UTF-8", encoding)
+			}
+			line = strings.TrimPrefix(line, "\uFEFF") // UTF-8 BOM
 		}
-		line = strings.TrimSpace(line)
+		content, comment, commented := splitComment(line)
+		line = strings.TrimSpace(content)
 		if len(line) == 0 {
+			if commented {
+				stats.Comments++
+			}
 			continue
 		}
 		if md := sectionRe.FindStringSubmatch(line); md != nil {
-			section = md[1]
+			if md[2] != "" {
+				// Trailing whitespace was already trimmed from line, so
+				// anything left is unexpected.
+				if c.onInvalidLine != nil {
+					if err := c.onInvalidLine(raw, lineNumber); err != nil {
+						return err
+					}
+					continue
+				}
+				return fmt.Errorf("invalid section header: [%s]: unexpected content after closing bracket: %q", line, md[2])
+			}
+			section = c.sectionName(md[1])
+			sawHeader = true
+			if onSection != nil {
+				if err := onSection(section, comment, lineNumber); err != nil {
+					return err
+				}
+			}
 		} else if md := keyValRe.FindStringSubmatch(line); md != nil {
-			if conf[section] == nil {
-				conf[section] = make(map[string]string)
+			if c.requireSection && !sawHeader {
+				return fmt.Errorf("key before first section header at line %d: [%s]", lineNumber, line)
+			}
+			value := md[2]
+			if c.preserveTrailingSpace {
+				value += content[len(strings.TrimRightFunc(content, unicode.IsSpace)):]
+			}
+			if c.trimQuotes {
+				value = trimQuotes(value)
+			}
+			if err := onKey(section, c.keyName(md[1]), value, lineNumber); err != nil {
+				return err
+			}
+		} else if c.onInvalidLine != nil {
+			if err := c.onInvalidLine(raw, lineNumber); err != nil {
+				return err
 			}
-			conf[section][md[1]] = md[2]
 		} else {
-			err = fmt.Errorf("invalid config line: [%s]", line)
-			return
+			return fmt.Errorf("invalid config line: [%s]", line)
+		}
+	}
+	return buf.Err()
+}
+
+// splitComment returns the content of line before the first semicolon that
+// begins a comment, with escapes removed, along with the text of the comment
+// and whether there is one.  A backslash before a semicolon escapes it, so
+// `\;` stands for a literal semicolon.  Backslashes only escape when they
+// precede a semicolon, where each pair stands for one literal backslash, so
+// `\\;` is a backslash followed by a comment.  Any other backslash, such as
+// those of `\\server\share`, is taken literally.
+func splitComment(line string) (string, string, bool) {
+	var content strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch b := line[i]; b {
+		case '\\':
+			run := 1
+			for i+run < len(line) && line[i+run] == '\\' {
+				run++
+			}
+			if i+run < len(line) && line[i+run] == ';' {
+				content.WriteString(strings.Repeat(`\`, run/2))
+				if run%2 == 0 {
+					return content.String(), strings.TrimSpace(line[i+run+1:]), true
+				}
+				content.WriteByte(';')
+				i += run
+				continue
+			}
+			content.WriteString(line[i : i+run])
+			i += run - 1
+		case ';':
+			return content.String(), strings.TrimSpace(line[i+1:]), true
+		default:
+			content.WriteByte(b)
+		}
+	}
+	return content.String(), "", false
+}
+
+// unsupportedBOM returns the name of the encoding indicated by a byte order
+// mark at the start of line when it is an encoding other than UTF-8, or the
+// empty string otherwise.
+func unsupportedBOM(line string) string {
+	switch {
+	case strings.HasPrefix(line, "\x00\x00\xFE\xFF"):
+		return "UTF-32BE"
+	case strings.HasPrefix(line, "\xFF\xFE\x00\x00"):
+		return "UTF-32LE" // checked before UTF-16LE, which it begins with
+	case strings.HasPrefix(line, "\xFE\xFF"):
+		return "UTF-16BE"
+	case strings.HasPrefix(line, "\xFF\xFE"):
+		return "UTF-16LE"
+	}
+	return ""
+}
+
+// scanLines is a bufio.SplitFunc like bufio.ScanLines, except that it accepts
+// a lone carriage return as a line ending in addition to a newline or a
+// carriage return followed by a newline, so files using any of those line
+// ending styles, or a mix of them, split into the same lines.
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+		// Need more data to know whether a newline follows the carriage
+		// return.
+		return 0, nil, nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// trimQuotes returns value without its outer quote characters when it both
+// begins and ends with the same quote character, and unchanged otherwise.
+func trimQuotes(value string) string {
+	if len(value) >= 2 {
+		if q := value[0]; (q == '"' || q == '\'') && value[len(value)-1] == q {
+			return value[1 : len(value)-1]
 		}
 	}
-	return
+	return value
 }
@@ -0,0 +1,296 @@
+package goconf
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// writeTestFile creates a configuration file holding contents in a temporary
+// directory and returns its pathname.
+func writeTestFile(t *testing.T, contents string) string {
+	t.Helper()
+	pathname := filepath.Join(t.TempDir(), "test.conf")
+	if err := os.WriteFile(pathname, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return pathname
+}
+
+func TestSectionListResolvesSecrets(t *testing.T) {
+	pathname := writeTestFile(t, "[server]\nhost = @secret:h\n[server]\nhost = @secret:h2\nport = ${PORT}\n")
+	var warned []string
+	c, err := New(pathname,
+		SecretResolver(func(ref string) (string, error) { return "RESOLVED-" + ref, nil }),
+		WarnUnresolved(func(section, key, value string) { warned = append(warned, section+"."+key+"="+value) }),
+		RecordSectionBlocks(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	blocks, err := c.SectionList("server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]string{
+		{"host": "RESOLVED-h"},
+		{"host": "RESOLVED-h2", "port": "${PORT}"},
+	}
+	if !reflect.DeepEqual(blocks, want) {
+		t.Errorf("GOT: %v; WANT: %v", blocks, want)
+	}
+	if want := []string{"server.port=${PORT}"}; !reflect.DeepEqual(warned, want) {
+		t.Errorf("GOT: %v; WANT: %v", warned, want)
+	}
+}
+
+func TestSplitComment(t *testing.T) {
+	cases := []struct {
+		line, content, comment string
+		commented              bool
+	}{
+		{`a = b`, `a = b`, ``, false},
+		{`a = b ; note`, `a = b `, `note`, true},
+		{`a = x\;y`, `a = x;y`, ``, false},
+		{`a = x\\;y`, `a = x\`, `y`, true},
+		{`a = x\\\;y`, `a = x\;y`, ``, false},
+		{`share = \\server\share`, `share = \\server\share`, ``, false},
+		{`re = ^\d+\\$`, `re = ^\d+\\$`, ``, false},
+		{`a = b\`, `a = b\`, ``, false},
+	}
+	for _, tc := range cases {
+		content, comment, commented := splitComment(tc.line)
+		if content != tc.content || comment != tc.comment || commented != tc.commented {
+			t.Errorf("%q: GOT: %q, %q, %v; WANT: %q, %q, %v", tc.line, content, comment, commented, tc.content, tc.comment, tc.commented)
+		}
+	}
+}
+
+func TestNoImplicitDefaultAfterUnset(t *testing.T) {
+	c, err := New(writeTestFile(t, "k = !unset\n[s]\na = 1\n"), NoImplicitDefault())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if n, err := c.SectionCount(); err != nil || n != 1 {
+		t.Errorf("GOT: %d, %v; WANT: 1, nil", n, err)
+	}
+	if _, err := c.Default(); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("GOT: %v; WANT: %v", err, ErrSectionNotFound)
+	}
+}
+
+func TestScanLines(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"empty", "", nil},
+		{"LF", "a\nb\n", []string{"a", "b"}},
+		{"CRLF", "a\r\nb\r\n", []string{"a", "b"}},
+		{"lone CR", "a\rb\r", []string{"a", "b"}},
+		{"mixed", "a\nb\r\nc\rd", []string{"a", "b", "c", "d"}},
+		{"no final ending", "a\nb", []string{"a", "b"}},
+		{"blank lines", "\n\r\n\r", []string{"", "", ""}},
+		{"CR then CRLF", "a\r\r\nb", []string{"a", "", "b"}},
+		{"final CR", "a\r", []string{"a"}},
+	}
+	for _, tc := range cases {
+		// Reading one byte at a time leaves a carriage return at the end
+		// of the buffer, before the byte that follows it is known.
+		for _, oneByte := range []bool{false, true} {
+			var r io.Reader = strings.NewReader(tc.input)
+			if oneByte {
+				r = iotest.OneByteReader(r)
+			}
+			buf := bufio.NewScanner(r)
+			buf.Split(scanLines)
+			var got []string
+			for buf.Scan() {
+				got = append(got, buf.Text())
+			}
+			if err := buf.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("%s (one byte: %v): GOT: %q; WANT: %q", tc.name, oneByte, got, tc.want)
+			}
+		}
+	}
+}
+
+func TestPreserveTrailingSpace(t *testing.T) {
+	contents := "[s]\nsep =  | \nnote = x  ; comment\nkey  =  v\n"
+	cases := []struct {
+		name    string
+		setters []ConfigSetter
+		want    map[string]string
+	}{
+		{"default", nil, map[string]string{"sep": "|", "note": "x", "key": "v"}},
+		{"preserve", []ConfigSetter{PreserveTrailingSpace()}, map[string]string{"sep": "| ", "note": "x  ", "key": "v"}},
+	}
+	for _, tc := range cases {
+		conf, err := Parse(strings.NewReader(contents), tc.setters...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := conf["s"]; !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: GOT: %q; WANT: %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSectionListRequiresRecordSectionBlocks(t *testing.T) {
+	c, err := New(writeTestFile(t, "[server]\nhost = a\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.SectionList("server"); err == nil {
+		t.Error("GOT: nil error; WANT: error")
+	}
+}
+
+func TestSectionListOfProfileAfterReset(t *testing.T) {
+	var n int
+	c, err := New(writeTestFile(t, "[x]\nj = 1\n[x:dev]\nk = @secret:b\n"),
+		SecretResolver(func(ref string) (string, error) {
+			n++
+			return fmt.Sprintf("S-%s%d", ref, n), nil
+		}),
+		RecordSectionBlocks(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	view, err := c.Profile("dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer view.Close()
+
+	for i := 0; i < 2; i++ {
+		if i > 0 {
+			if err := view.Reset(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		sect, err := view.Section("x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks, err := view.SectionList("x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []map[string]string{{"j": "1"}, {"k": sect["k"]}}
+		if !reflect.DeepEqual(blocks, want) {
+			t.Errorf("pass %d: GOT: %v; WANT: %v", i, blocks, want)
+		}
+	}
+}
+
+func TestSectionListAcrossSources(t *testing.T) {
+	c, err := NewJSON([]byte(`{"s":{"a":"1"}}`), RecordSectionBlocks())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	blocks, err := c.SectionList("s")
+	if want := []map[string]string{{"a": "1"}}; err != nil || !reflect.DeepEqual(blocks, want) {
+		t.Errorf("GOT: %v, %v; WANT: %v", blocks, err, want)
+	}
+}
+
+func TestRunThenClose(t *testing.T) {
+	c, err := New(writeTestFile(t, "[s]\na = 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Run(ctx) }()
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("Close after Run: %v", err)
+	}
+	if err := c.Reset(); err == nil {
+		t.Error("Reset after Close: GOT: nil error; WANT: error")
+	}
+	if err := c.SetTTL(time.Minute); err == nil {
+		t.Error("SetTTL after Close: GOT: nil error; WANT: error")
+	}
+}
+
+func TestIndentedHeadersAndKeys(t *testing.T) {
+	cases := []struct {
+		name     string
+		contents string
+		want     map[string]map[string]string
+	}{
+		{
+			"spaces",
+			"  [a]\n    x = 1\n  [b]\n  y = 2\n",
+			map[string]map[string]string{"General": {}, "a": {"x": "1"}, "b": {"y": "2"}},
+		},
+		{
+			"tabs",
+			"\t[a]\n\t\tx = 1\n\t[b]\n\ty = 2\n",
+			map[string]map[string]string{"General": {}, "a": {"x": "1"}, "b": {"y": "2"}},
+		},
+		{
+			"mixed",
+			"top = 0\n \t[a] ; note\n\t x = 1\n[b]\n\t  y = 2\n",
+			map[string]map[string]string{"General": {"top": "0"}, "a": {"x": "1"}, "b": {"y": "2"}},
+		},
+	}
+	for _, tc := range cases {
+		got, err := Parse(strings.NewReader(tc.contents))
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: GOT: %v; WANT: %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSeparatorInValue(t *testing.T) {
+	cases := []struct {
+		line, key, value string
+	}{
+		{"query = SELECT * WHERE a=1", "query", "SELECT * WHERE a=1"},
+		{"query=SELECT * WHERE a=1", "query", "SELECT * WHERE a=1"},
+		{"eq   =  a = b = c", "eq", "a = b = c"},
+		{"url = http://h/?x=1&y=2", "url", "http://h/?x=1&y=2"},
+		{"time = 12:30:45", "time", "12:30:45"},
+	}
+	for _, tc := range cases {
+		got, err := Parse(strings.NewReader("[s]\n" + tc.line + "\n"))
+		if err != nil {
+			t.Errorf("%q: %v", tc.line, err)
+			continue
+		}
+		if want := map[string]string{tc.key: tc.value}; !reflect.DeepEqual(got["s"], want) {
+			t.Errorf("%q: GOT: %q; WANT: %q", tc.line, got["s"], want)
+		}
+	}
+}
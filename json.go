@@ -0,0 +1,83 @@
+package goconf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// NewJSON returns a new Config data structure whose sections are taken from
+// data, a JSON object mapping section names to objects of key-value pairs, as
+// in `{"section": {"key": "value"}}`.  Number and boolean values are converted
+// to their literal text so they may be read back through the same accessors as
+// values parsed from a file, and null values become empty strings.
+func NewJSON(data []byte, setters ...ConfigSetter) (*Config, error) {
+	var raw map[string]map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("cannot decode JSON config: %s", err)
+	}
+
+	conf := make(map[string]map[string]string, len(raw))
+	for name, section := range raw {
+		dict := make(map[string]string, len(section))
+		for key, value := range section {
+			switch v := value.(type) {
+			case string:
+				dict[key] = v
+			case json.Number:
+				dict[key] = v.String()
+			case bool:
+				if v {
+					dict[key] = "true"
+				} else {
+					dict[key] = "false"
+				}
+			case nil:
+				dict[key] = ""
+			default:
+				return nil, fmt.Errorf("cannot decode JSON config: section %q key %q: value must be a string, number, boolean, or null", name, key)
+			}
+		}
+		conf[name] = dict
+	}
+
+	c := &Config{}
+	c.load = func(*ParseStats) (map[string]*section, error) {
+		sections := c.sectionsFromMaps(conf)
+		if sections[c.defaultSection] == nil {
+			sections[c.defaultSection] = newSection() // always a default section
+		}
+		return sections, nil
+	}
+	return c.init(setters)
+}
+
+// sectionsFromMaps returns newly allocated sections holding the key-value
+// pairs of conf, so callers may not mutate conf through them.  Section names
+// and keys are normalized, and because maps have no order, keys are ordered by
+// sorting.
+func (c *Config) sectionsFromMaps(conf map[string]map[string]string) map[string]*section {
+	sections := make(map[string]*section, len(conf))
+	for name, dict := range conf {
+		name = c.sectionName(name)
+		sect, ok := sections[name]
+		if !ok {
+			sect = newSection()
+			sections[name] = sect
+		}
+		var block map[string]string
+		if c.recordBlocks && len(dict) > 0 {
+			block = make(map[string]string, len(dict))
+			sect.blocks = append(sect.blocks, block)
+		}
+		for _, key := range sortedKeys(dict) {
+			sect.set(c.keyName(key), dict[key], origin{})
+			if block != nil {
+				block[c.keyName(key)] = dict[key]
+			}
+		}
+	}
+	return sections
+}
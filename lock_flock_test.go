@@ -0,0 +1,67 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package goconf
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestLockFileReleasedOnClose(t *testing.T) {
+	pathname := writeTestFile(t, "[a]\nk = 1\n")
+	held, err := os.Open(pathname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = lockFile(held); err != nil {
+		t.Fatal(err)
+	}
+	other, err := os.Open(pathname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	if err = syscall.Flock(int(other.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != syscall.EWOULDBLOCK {
+		t.Errorf("GOT: %v; WANT: %v", err, syscall.EWOULDBLOCK)
+	}
+	held.Close()
+	if err = syscall.Flock(int(other.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		t.Errorf("GOT: %v; WANT: %v", err, nil)
+	}
+}
+
+func TestAppendSectionWaitsForFileLock(t *testing.T) {
+	pathname := writeTestFile(t, "[a]\nk = 1\n")
+	c, err := New(pathname, FileLock())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	held, err := os.Open(pathname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = lockFile(held); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- c.AppendSection("n", map[string]string{"k": "2"}) }()
+
+	select {
+	case err = <-done:
+		t.Fatalf("GOT: %v; WANT: AppendSection to wait for the lock", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	held.Close()
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Section("n"); err != nil {
+		t.Error(err)
+	}
+}
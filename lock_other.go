@@ -0,0 +1,14 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package goconf
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// lockFile returns an error, because this platform has no flock.
+func lockFile(fh *os.File) error {
+	return fmt.Errorf("file locking not supported on %s", runtime.GOOS)
+}
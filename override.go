@@ -0,0 +1,55 @@
+package goconf
+
+import "errors"
+
+// Override sets key in the section called name to value for every later lookup
+// made through c, without changing the configuration it was read from.
+// Overrides take precedence over the configuration: Section, SectionOrdered,
+// KeyCount, Provenance, and the accessors built on them first consult the
+// overrides and then the cached or freshly parsed configuration, so an
+// override applies even to a section or key the configuration lacks.  An
+// overridden value has no file or line.
+//
+// Overrides live only in memory.  They are never written by SaveOverlay,
+// AppendSection, or Reader, they are not seen by methods that read the
+// configuration as a whole, such as SectionsMatching, FlatKeys, or ToTOML, and
+// they are discarded by Reset.
+func (c *Config) Override(name, key, value string) {
+	name, key = c.sectionName(name), c.keyName(key)
+	c.overrideLock.Lock()
+	defer c.overrideLock.Unlock()
+	if c.overrides == nil {
+		c.overrides = make(map[string]*section)
+	}
+	sect, ok := c.overrides[name]
+	if !ok {
+		sect = newSection()
+		c.overrides[name] = sect
+	}
+	sect.set(key, value, origin{})
+}
+
+// overridden returns sect, the section called name along with the error from
+// loading it, with any overrides of that section applied.  The cached sect is
+// never modified, and a section missing from the configuration is created
+// when it has overrides.
+func (c *Config) overridden(name string, sect *section, err error) (*section, error) {
+	c.overrideLock.RLock()
+	defer c.overrideLock.RUnlock()
+	over, ok := c.overrides[name]
+	if !ok {
+		return sect, err
+	}
+	if err != nil {
+		if !errors.Is(err, ErrSectionNotFound) {
+			return nil, err
+		}
+		sect = newSection()
+	} else {
+		sect = sect.clone()
+	}
+	for _, key := range over.keys {
+		sect.set(key, over.values[key], origin{})
+	}
+	return sect, nil
+}
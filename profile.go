@@ -0,0 +1,48 @@
+package goconf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Profile returns a view of the configuration for the profile called name, in
+// which the key-value pairs of each section called "x:name" override those of
+// the section called "x", which is created when it does not exist.  The
+// "x:name" sections themselves do not appear in the view, while sections of
+// other profiles appear unchanged.
+//
+// The configuration is parsed once, when Profile is called, and each section
+// of the view is computed from that parse when first accessed.  The view has
+// the options of c, but it never reads the configuration again, so it does not
+// observe later changes to it, and Reset and SetTTL on the view only discard
+// computed sections.  Close the view when it is no longer needed.
+func (c *Config) Profile(name string) (*Config, error) {
+	if name == "" || strings.ContainsAny(name, ":") {
+		return nil, fmt.Errorf("invalid profile name: %q", name)
+	}
+	// Unset markers stay in place until the view merges the profile
+	// sections, so a marker in "x:name" removes the key from "x".
+	conf, err := c.merged(new(ParseStats))
+	if err != nil {
+		return nil, err
+	}
+
+	view := &Config{pathname: c.pathname, dir: c.dir, options: c.options}
+	view.envImports = nil // already merged into conf
+	view.load = func(*ParseStats) (map[string]*section, error) {
+		suffix := c.sectionName(":" + name)
+		merged := make(map[string]*section, len(conf))
+		for sectName, sect := range conf {
+			if !strings.HasSuffix(sectName, suffix) {
+				merged[sectName] = sect.clone()
+			}
+		}
+		for sectName, sect := range conf {
+			if base := strings.TrimSuffix(sectName, suffix); base != sectName {
+				mergeSections(merged, map[string]*section{base: sect})
+			}
+		}
+		return merged, nil
+	}
+	return view.init(nil)
+}
@@ -0,0 +1,99 @@
+package goconf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProfileOfDirResolvesPaths(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.conf"), []byte("[s]\nlogs = logs\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewDir(dir, ResolvePaths())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	view, err := c.Profile("dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer view.Close()
+
+	got, err := view.GetPath("s", "logs")
+	if want := filepath.Join(dir, "logs"); err != nil || got != want {
+		t.Errorf("GOT: %q, %v; WANT: %q", got, err, want)
+	}
+}
+
+func TestProfileUnsetsBaseKey(t *testing.T) {
+	c, err := New(writeTestFile(t, "[x]\nk = 1\nj = 2\n[x:prod]\nk = !unset\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	view, err := c.Profile("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer view.Close()
+
+	got, err := view.Section("x")
+	if want := map[string]string{"j": "2"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("GOT: %v, %v; WANT: %v", got, err, want)
+	}
+	if got, err := c.Section("x"); err != nil || got["k"] != "1" {
+		t.Errorf("GOT: %v, %v; WANT: k = 1 without the profile", got, err)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	c, err := New(writeTestFile(t, "[x]\nk = 1\nj = 2\n[x:dev]\nk = 3\n[y:dev]\ny = 4\n[x:prod]\nk = 5\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	view, err := c.Profile("dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer view.Close()
+
+	tests := []struct {
+		section string
+		want    map[string]string
+	}{
+		{"x", map[string]string{"k": "3", "j": "2"}},
+		{"y", map[string]string{"y": "4"}},
+		{"x:prod", map[string]string{"k": "5"}},
+	}
+	for _, tc := range tests {
+		got, err := view.Section(tc.section)
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: GOT: %v, %v; WANT: %v", tc.section, got, err, tc.want)
+		}
+	}
+	for _, section := range []string{"x:dev", "y:dev"} {
+		if _, err = view.Section(section); !errors.Is(err, ErrSectionNotFound) {
+			t.Errorf("%s: GOT: %v; WANT: %v", section, err, ErrSectionNotFound)
+		}
+	}
+}
+
+func TestProfileInvalidName(t *testing.T) {
+	c, err := New(writeTestFile(t, "[x]\nk = 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for _, name := range []string{"", "a:b"} {
+		if _, err = c.Profile(name); err == nil || !strings.Contains(err.Error(), "invalid profile name") {
+			t.Errorf("%q: GOT: %v; WANT: invalid profile name", name, err)
+		}
+	}
+}
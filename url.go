@@ -0,0 +1,57 @@
+package goconf
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultTimeout is how long a single fetch of a remote configuration may take
+// when no Timeout is specified.
+const DefaultTimeout = 30 * time.Second
+
+// NewURL returns a new Config data structure whose configuration is fetched
+// from rawurl, which must be an http or https URL.  The response body is
+// parsed exactly like a configuration file.  Like re-reading a file, the
+// configuration is fetched again when sections expire from the cache after the
+// TTL.  Each fetch is bounded by the Timeout, which defaults to DefaultTimeout,
+// and any response other than 200 OK is an error.
+func NewURL(rawurl string, setters ...ConfigSetter) (*Config, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported URL scheme: %q", u.Scheme)
+	}
+
+	c := &Config{options: options{timeout: DefaultTimeout}}
+	c.load = func(stats *ParseStats) (map[string]*section, error) {
+		return c.fetch(rawurl, stats)
+	}
+	return c.init(setters)
+}
+
+// fetch fetches and parses the remote configuration at rawurl using the parsing
+// options of c, tallying what it reads in stats.
+func (c *Config) fetch(rawurl string, stats *ParseStats) (map[string]*section, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodGet, rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot fetch config from %q: %s", rawurl, resp.Status)
+	}
+	return c.parse(resp.Body, rawurl, stats)
+}
@@ -0,0 +1,83 @@
+package goconf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewURLFetchesBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[remote]\nkey = value\n"))
+	}))
+	defer srv.Close()
+
+	c, err := NewURL(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	values, err := c.Section("remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := values["key"], "value"; got != want {
+		t.Errorf("GOT: %q; WANT: %q", got, want)
+	}
+}
+
+func TestNewURLRejectsStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	c, err := NewURL(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_, err = c.Section("remote")
+	if err == nil || !strings.Contains(err.Error(), "cannot fetch config") || !strings.Contains(err.Error(), "404 Not Found") {
+		t.Errorf("GOT: %v; WANT: cannot fetch config ... 404 Not Found", err)
+	}
+}
+
+func TestNewURLTimeout(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	c, err := NewURL(srv.URL, Timeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	start := time.Now()
+	if _, err = c.Section("remote"); err == nil {
+		t.Fatal("GOT: nil; WANT: timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("GOT: %v; WANT: prompt timeout", elapsed)
+	}
+}
+
+func TestNewURLRejectsScheme(t *testing.T) {
+	for _, rawurl := range []string{"ftp://example.com/app.conf", "/etc/app.conf"} {
+		_, err := NewURL(rawurl)
+		if err == nil || !strings.Contains(err.Error(), "unsupported URL scheme") {
+			t.Errorf("%s: GOT: %v; WANT: unsupported URL scheme", rawurl, err)
+		}
+	}
+}
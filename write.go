@@ -0,0 +1,384 @@
+package goconf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// SaveOverlay writes to w, in configuration file syntax, only those key-value
+// pairs of c that are absent from base or have a different value there, so
+// reading the output as an overlay on top of base reproduces c.  Sections are
+// written in sorted order and keys in the order they appear in c.  A key of
+// base that is absent from the same section of c, including every key of a
+// section that c lacks entirely, is written with the unset marker of c so the
+// overlay removes it, unless the marker is disabled.  A section of base that
+// is emptied this way remains in the overlaid configuration, without keys.
+func (c *Config) SaveOverlay(w io.Writer, base *Config) error {
+	conf, err := c.sections()
+	if err != nil {
+		return err
+	}
+	baseConf, err := base.sections()
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	if err = c.writeHeader(bw); err != nil {
+		return err
+	}
+	// Sections of base that c lacks have every key unset.
+	names := sortedSectionNames(conf)
+	for name := range baseConf {
+		if _, ok := conf[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var written int
+	for _, name := range names {
+		var pairs []KeyValue
+		var comment string
+		sect, baseSect := conf[name], baseConf[name]
+		if sect != nil {
+			comment = sect.comment
+			for _, kv := range sect.ordered() {
+				if baseSect != nil {
+					if value, ok := baseSect.values[kv.Key]; ok && value == kv.Value {
+						continue
+					}
+				}
+				pairs = append(pairs, kv)
+			}
+		}
+		if baseSect != nil && c.unsetMarker != "" {
+			for _, key := range baseSect.keys {
+				if sect != nil {
+					if _, ok := sect.values[key]; ok {
+						continue
+					}
+				}
+				pairs = append(pairs, KeyValue{Key: key, Value: c.unsetMarker})
+			}
+		}
+		if len(pairs) == 0 {
+			continue
+		}
+		if written > 0 {
+			if _, err = bw.WriteString("\n"); err != nil {
+				return err
+			}
+		}
+		if err = writeSection(bw, name, comment, pairs); err != nil {
+			return err
+		}
+		written++
+	}
+	return bw.Flush()
+}
+
+// FileLock mutates a new Config data structure so that AppendSection holds an
+// exclusive advisory lock, using flock(2), on the configuration file itself
+// while writing to it, so processes appending to the same file with FileLock
+// do not interleave their writes.  No separate lock file is created, so there
+// is nothing to clean up, and the lock is released when the write completes
+// or the process exits.  The lock does not stop processes that do not take
+// it.  On platforms without flock, AppendSection returns an error rather than
+// writing without the lock.
+func FileLock() func(*Config) error {
+	return func(c *Config) error {
+		c.fileLock = true
+		return nil
+	}
+}
+
+// WriteHeader mutates a new Config data structure so that the configuration
+// it writes begins with lines, each written as a comment, followed by a blank
+// line.  Because the header is made of comments, it is ignored when the output
+// is read back.
+func WriteHeader(lines []string) func(*Config) error {
+	return func(c *Config) error {
+		for _, line := range lines {
+			if strings.ContainsAny(line, "\r\n") {
+				return fmt.Errorf("header line must not contain a line break: %q", line)
+			}
+		}
+		c.header = append([]string(nil), lines...)
+		return nil
+	}
+}
+
+// writeHeader writes the configured header of c to w.
+func (c *Config) writeHeader(w io.Writer) error {
+	if len(c.header) == 0 {
+		return nil
+	}
+	for _, line := range c.header {
+		if _, err := fmt.Fprintf(w, "; %s\n", line); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// escape returns s with each semicolon escaped, along with any backslashes
+// before it, so s reads back unchanged rather than beginning a comment.
+func escape(s string) string {
+	if strings.IndexByte(s, ';') < 0 {
+		return s
+	}
+	var buf strings.Builder
+	var run int // backslashes seen since the last other byte
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			run++
+			continue
+		case ';':
+			buf.WriteString(strings.Repeat(`\`, 2*run+1))
+		default:
+			buf.WriteString(strings.Repeat(`\`, run))
+		}
+		run = 0
+		buf.WriteByte(s[i])
+	}
+	buf.WriteString(strings.Repeat(`\`, run))
+	return buf.String()
+}
+
+// writeSection writes pairs to w as a section called name, in configuration
+// file syntax, with comment, when not empty, following the section header.
+// Semicolons are escaped.  It returns an error for a name,
+// key, or value that would not read back unchanged.
+func writeSection(w io.Writer, name, comment string, pairs []KeyValue) error {
+	if name == "" || strings.ContainsAny(name, "]\r\n") || strings.TrimSpace(name) != name {
+		return fmt.Errorf("cannot write section name: %q", name)
+	}
+	var err error
+	if comment != "" {
+		_, err = fmt.Fprintf(w, "[%s] ; %s\n", escape(name), comment)
+	} else {
+		_, err = fmt.Fprintf(w, "[%s]\n", escape(name))
+	}
+	if err != nil {
+		return err
+	}
+	for _, kv := range pairs {
+		if kv.Key == "" || kv.Key[0] == '[' || strings.ContainsAny(kv.Key, "=\r\n") || strings.TrimSpace(kv.Key) != kv.Key {
+			return fmt.Errorf("cannot write key in section %q: %q", name, kv.Key)
+		}
+		if kv.Value == "" || strings.ContainsAny(kv.Value, "\r\n") || strings.TrimSpace(kv.Value) != kv.Value {
+			return fmt.Errorf("cannot write value for key %q in section %q: %q", kv.Key, name, kv.Value)
+		}
+		if _, err := fmt.Fprintf(w, "%s = %s\n", escape(kv.Key), escape(kv.Value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeConfig writes the header of c followed by every section of conf to w,
+// in configuration file syntax.  Sections are written in sorted order and keys
+// in their recorded order.
+func (c *Config) writeConfig(w io.Writer, conf map[string]*section) error {
+	bw := bufio.NewWriter(w)
+	if err := c.writeHeader(bw); err != nil {
+		return err
+	}
+	for i, name := range sortedSectionNames(conf) {
+		if i > 0 {
+			if _, err := bw.WriteString("\n"); err != nil {
+				return err
+			}
+		}
+		sect := conf[name]
+		if err := writeSection(bw, name, sect.comment, sect.ordered()); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Reader returns a reader of the whole configuration, header included, in
+// configuration file syntax, with sections in sorted order and keys in their
+// recorded order.  The output is rendered before Reader returns, so a name,
+// key, or value that cannot be written is reported by Reader itself, and the
+// returned reader may be abandoned at any point without releasing anything.
+func (c *Config) Reader() (io.Reader, error) {
+	conf, err := c.sections()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err = c.writeConfig(&buf, conf); err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(buf.Bytes()), nil
+}
+
+// CheckRoundTrip parses configuration read from r, writes it in configuration
+// file syntax, parses what was written, and returns an error describing every
+// difference between the two parses, including differences in key order or
+// in section header comments.  It returns an error as well when r cannot be
+// parsed or contains a value that cannot be written.  The default parsing
+// options are used.
+func CheckRoundTrip(r io.Reader) error {
+	c := new(Config)
+	if err := c.configure(nil); err != nil {
+		return err
+	}
+	first, err := c.parse(r, "", new(ParseStats))
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err = c.writeConfig(&buf, first); err != nil {
+		return err
+	}
+	second, err := c.parse(&buf, "", new(ParseStats))
+	if err != nil {
+		return fmt.Errorf("cannot parse written configuration: %s", err)
+	}
+	if diffs := diffSections(first, second); len(diffs) > 0 {
+		return fmt.Errorf("configuration does not survive a round trip:\n%s", strings.Join(diffs, "\n"))
+	}
+	return nil
+}
+
+// diffSections returns a line describing each difference between the sections
+// of a and those of b, with "-" marking what only a has and "+" marking what
+// only b has.
+func diffSections(a, b map[string]*section) []string {
+	var diffs []string
+	names := make(map[string]struct{}, len(a)+len(b))
+	for name := range a {
+		names[name] = struct{}{}
+	}
+	for name := range b {
+		names[name] = struct{}{}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		sa, sb := a[name], b[name]
+		switch {
+		case sb == nil:
+			diffs = append(diffs, fmt.Sprintf("- [%s]", name))
+			continue
+		case sa == nil:
+			diffs = append(diffs, fmt.Sprintf("+ [%s]", name))
+			continue
+		}
+		if sa.comment != sb.comment {
+			diffs = append(diffs, fmt.Sprintf("- [%s] ; %s", name, sa.comment), fmt.Sprintf("+ [%s] ; %s", name, sb.comment))
+		}
+		if len(sa.keys) == len(sb.keys) && strings.Join(sa.keys, "\n") != strings.Join(sb.keys, "\n") {
+			// Key order only matters when neither side has a key the other
+			// lacks, which the comparisons below report.
+			diffs = append(diffs, fmt.Sprintf("- [%s] key order: %q", name, sa.keys), fmt.Sprintf("+ [%s] key order: %q", name, sb.keys))
+		}
+		for _, key := range sa.keys {
+			if value, ok := sb.values[key]; !ok || value != sa.values[key] {
+				diffs = append(diffs, fmt.Sprintf("- [%s] %s = %s", name, key, sa.values[key]))
+				if ok {
+					diffs = append(diffs, fmt.Sprintf("+ [%s] %s = %s", name, key, value))
+				}
+			}
+		}
+		for _, key := range sb.keys {
+			if _, ok := sa.values[key]; !ok {
+				diffs = append(diffs, fmt.Sprintf("+ [%s] %s = %s", name, key, sb.values[key]))
+			}
+		}
+	}
+	return diffs
+}
+
+// AppendSection appends a new section called name, holding the key-value pairs
+// of kv in sorted key order, to the end of the configuration file, leaving the
+// existing contents of the file untouched.  It returns an error when the
+// configuration already has a section called name, when kv is empty, or when
+// c was not created from a configuration file.  Sections already in the cache
+// remain valid, and the new section is read from the file when first accessed.
+func (c *Config) AppendSection(name string, kv map[string]string) error {
+	if c.pathname == "" {
+		return fmt.Errorf("cannot append section: configuration has no file")
+	}
+	if len(kv) == 0 {
+		// A section header without keys does not create a section when read.
+		return fmt.Errorf("cannot append section: section has no keys: %q", name)
+	}
+	pairs := make([]KeyValue, 0, len(kv))
+	for _, key := range sortedKeys(kv) {
+		pairs = append(pairs, KeyValue{Key: key, Value: kv[key]})
+	}
+	var buf bytes.Buffer
+	if err := writeSection(&buf, name, "", pairs); err != nil {
+		return err
+	}
+
+	fh, err := os.OpenFile(c.pathname, os.O_RDWR|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	if err = c.appendSection(fh, name, buf.Bytes()); err != nil {
+		fh.Close()
+		return err
+	}
+	return fh.Close()
+}
+
+// appendSection appends block, the rendered section called name, to fh, the
+// open configuration file.  With FileLock, the lock is taken before checking
+// that the section does not already exist, so no other process using FileLock
+// can append the same section between the check and the write.
+func (c *Config) appendSection(fh *os.File, name string, block []byte) error {
+	if c.fileLock {
+		// Closing the file releases the lock.
+		if err := lockFile(fh); err != nil {
+			return fmt.Errorf("cannot lock configuration file: %s", err)
+		}
+	}
+	conf, err := c.sections()
+	if err != nil {
+		return err
+	}
+	if _, ok := conf[c.sectionName(name)]; ok {
+		return fmt.Errorf("cannot append section: section already exists: %q", name)
+	}
+	return appendBlock(fh, block)
+}
+
+// appendBlock writes block to the end of fh, an open file, separated from any
+// existing contents by a blank line.
+func appendBlock(fh *os.File, block []byte) error {
+	fi, err := fh.Stat()
+	if err != nil {
+		return err
+	}
+	var prefix string
+	if size := fi.Size(); size > 0 {
+		last := make([]byte, 1)
+		if _, err = fh.ReadAt(last, size-1); err != nil {
+			return err
+		}
+		if last[0] == '\n' || last[0] == '\r' {
+			prefix = "\n"
+		} else {
+			prefix = "\n\n"
+		}
+	}
+	_, err = fh.Write(append([]byte(prefix), block...))
+	return err
+}
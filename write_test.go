@@ -0,0 +1,142 @@
+package goconf
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSaveOverlayUnsetsBaseOnlySections(t *testing.T) {
+	base, err := New(writeTestFile(t, "[keep]\nk = 1\n[gone]\ng = 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer base.Close()
+	c, err := New(writeTestFile(t, "[keep]\nk = 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var buf bytes.Buffer
+	if err = c.SaveOverlay(&buf, base); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "[gone]\ng = !unset\n"; got != want {
+		t.Errorf("GOT: %q; WANT: %q", got, want)
+	}
+}
+
+func TestEscapeReadsBack(t *testing.T) {
+	for _, value := range []string{`a;b`, `a\;b`, `a\\;b`, `\\server\share`, `x\`, `;`} {
+		content, _, commented := splitComment(escape(value))
+		if content != value || commented {
+			t.Errorf("%q: GOT: %q (commented: %v); WANT: %q", value, content, commented, value)
+		}
+	}
+}
+
+func TestReaderMatchesWriteConfig(t *testing.T) {
+	c, err := New(writeTestFile(t, "[b]\nz = 3\n[a] ; first\nx = 1\nsemi = p\\;q\n"), WriteHeader([]string{"generated"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	r, err := c.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := c.sections()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	if err = c.writeConfig(&want, conf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("GOT: %q; WANT: %q", got, want.Bytes())
+	}
+	if !bytes.HasPrefix(got, []byte("; generated\n\n[General]\n\n[a] ; first\nx = 1\nsemi = p\\;q\n")) {
+		t.Errorf("GOT: %q", got)
+	}
+}
+
+func TestReaderReportsUnwritableValue(t *testing.T) {
+	c, err := New(writeTestFile(t, "[s]\nk = v  \n"), PreserveTrailingSpace())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Reader(); err == nil {
+		t.Error("GOT: nil error; WANT: error")
+	}
+}
+
+func TestAppendSection(t *testing.T) {
+	pathname := writeTestFile(t, "[a]\nk = 1")
+	c, err := New(pathname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Reading the file first shows the new section is found without a Reset.
+	if _, err = c.Section("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.AppendSection("n", map[string]string{"semi": "p;q", "b": "2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(pathname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[a]\nk = 1\n\n[n]\nb = 2\nsemi = p\\;q\n"; string(got) != want {
+		t.Errorf("GOT: %q; WANT: %q", got, want)
+	}
+
+	values, err := c.Section("n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := values["semi"], "p;q"; got != want {
+		t.Errorf("GOT: %q; WANT: %q", got, want)
+	}
+}
+
+func TestAppendSectionAlreadyExists(t *testing.T) {
+	pathname := writeTestFile(t, "[a]\nk = 1\n")
+	overlay := filepath.Join(filepath.Dir(pathname), "test.env.conf")
+	if err := os.WriteFile(overlay, []byte("[o]\nk = 2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(pathname, EnvSuffix("env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for _, name := range []string{"a", "o"} {
+		err = c.AppendSection(name, map[string]string{"k": "3"})
+		if err == nil || !strings.Contains(err.Error(), "section already exists") {
+			t.Errorf("%s: GOT: %v; WANT: section already exists", name, err)
+		}
+	}
+	got, err := os.ReadFile(pathname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[a]\nk = 1\n"; string(got) != want {
+		t.Errorf("GOT: %q; WANT: %q", got, want)
+	}
+}